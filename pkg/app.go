@@ -4,11 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
-	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -17,8 +18,22 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/iteais/sdk/pkg/app"
+	"github.com/iteais/sdk/pkg/auth"
+	"github.com/iteais/sdk/pkg/health"
+	"github.com/iteais/sdk/pkg/jobs"
+	"github.com/iteais/sdk/pkg/lifecycle"
+	"github.com/iteais/sdk/pkg/lock"
+	"github.com/iteais/sdk/pkg/logging"
+	"github.com/iteais/sdk/pkg/metrics"
+	"github.com/iteais/sdk/pkg/ratelimit"
+	"github.com/iteais/sdk/pkg/scheduler"
+	"github.com/iteais/sdk/pkg/stream"
+	"github.com/iteais/sdk/pkg/tracing"
 	"github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 	log "github.com/sirupsen/logrus"
 	"github.com/swaggo/files"
 	"github.com/swaggo/gin-swagger"
@@ -26,43 +41,58 @@ import (
 )
 
 const (
-	HealthEndpoint  = "/health"
-	MetricsEndpoint = "/metrics"
-	ReadyEndpoint   = "/ready"
-	SwaggerEndpoint = "/swagger/*"
+	HealthEndpoint      = "/health"
+	LiveEndpoint        = "/health/live"
+	HealthReadyEndpoint = "/health/ready"
+	MetricsEndpoint     = "/metrics"
+	ReadyEndpoint       = "/ready"
+	SwaggerEndpoint     = "/swagger/*"
+
+	ScheduleEndpoint             = "/admin/schedule"
+	ApiAccountInvalidateEndpoint = "/admin/api-account/:key/invalidate"
+	PermissionExplainEndpoint    = "/admin/permissions/explain"
+	LogLevelEndpoint             = "/admin/log-level"
+	HealthReportEndpoint         = "/admin/health"
+
+	// ApiAccountInvalidatePermission must be granted to the role of the HMAC service account, see AppendApiAccountInvalidation.
+	ApiAccountInvalidatePermission = "api-account.invalidate"
+	// LogLevelPermission is required to change the log level, see AppendLogLevel.
+	LogLevelPermission = "log-level.update"
 )
 
-var isReady = &atomic.Value{}
-
-var hasSentry = os.Getenv("SENTRY_SERVER") != ""
-
 var App *Application
 
-func init() {
-	isReady.Store(false)
-
-	if hasSentry {
-
-		sampleRate := 1.0
-		if os.Getenv("ENVIRONMENT") == "DEV" {
-			sampleRate = 0.5
-		}
-
-		_ = sentry.Init(sentry.ClientOptions{
-			Dsn:              os.Getenv("SENTRY_SERVER"),
-			Debug:            os.Getenv("ENVIRONMENT") == "DEV",
-			Environment:      os.Getenv("ENVIRONMENT"),
-			EnableTracing:    true,
-			TracesSampleRate: sampleRate,
-		})
-	}
-}
-
 type Application struct {
-	Db      *bun.DB
-	Router  *gin.Engine
+	Db     *bun.DB
+	Router *gin.Engine
+	// Logger adds trace id, route, user and api key of the request to records logged with a context.
+	Logger *slog.Logger
+	// Log writes to Logger, it is kept for logrus users.
 	Log     *log.Logger
 	Storage *minio.Client
+	Redis   *redis.Client
+	Jobs    *jobs.Manager
+	Locker  lock.Locker
+
+	Scheduler   *scheduler.Scheduler
+	Stream      *stream.Hub
+	ApiAccounts *CachedAccountResolver
+	Jwt         *auth.Verifier
+	// Auth issues user tokens, nil without a signing key, see AppendAuth.
+	Auth *auth.Issuer
+	// Policy maps roles to permissions, see PermissionMiddleware.
+	Policy *auth.Policy
+	// Metrics registers service metrics prefixed with AppName, see AppendMetrics.
+	Metrics *metrics.Registry
+	// Health checks DB, Redis, S3 and downstream services for probes, custom checks can be registered too.
+	Health *health.Registry
+	// Lifecycle starts components before the server and stops them after it, see OnStart and OnStop.
+	Lifecycle *lifecycle.Lifecycle
+
+	shutdown ShutdownConfig
+	listener net.Listener
+	// tokenOptionalRoutes ("POST /auth/refresh") are served anonymously when User-Jwt is invalid, see AppendAuth.
+	tokenOptionalRoutes map[string]bool
 }
 
 type ApplicationConfig struct {
@@ -70,80 +100,289 @@ type ApplicationConfig struct {
 	MigrationPath string
 	DbSchemaName  string
 	WhiteList     []string
+	Jobs          jobs.Config
+	Stream        stream.Config
+	Idempotency   IdempotencyConfig
+	HmacCache     CachedAccountResolverConfig
+	// Hmac configures HmacMiddleware. Resolver and WhiteList are filled from HmacCache and WhiteList.
+	Hmac HmacConfig
+	// TrustedProxies are CIDRs of proxies whose X-Forwarded-For is used as the client IP.
+	// By default forwarding headers are ignored, otherwise any client could spoof a trusted IP.
+	TrustedProxies []string
+	// Jwt configures verification of user tokens. Empty config is read from env by auth.VerifierConfigFromEnv.
+	Jwt auth.VerifierConfig
+	// Auth configures issuing of user tokens. By default tokens are signed with HS256 and JWT_SECRET,
+	// Issuer and Audience are taken from Jwt.
+	Auth auth.IssuerConfig
+	// RevocationPrefix is the Redis key prefix of revoked tokens, auth.DefaultRevocationPrefix by default.
+	// It must be the same in the issuing service and in all verifying services.
+	// Without Redis revocations are kept in the service database and cached in process for 30s:
+	// logout revokes access tokens only in the issuing service.
+	RevocationPrefix string
+	// Policy configures permissions of roles. Without Roles and Source they are loaded from sdk_role_permissions.
+	Policy auth.PolicyConfig
+	// Cors configures CorsMiddleware, by default any origin without credentials.
+	Cors CorsConfig
+	// RateLimit configures RateLimitIpMiddleware and RateLimitMiddleware, they are installed when a limit is set.
+	RateLimit RateLimitConfig
+	// Tracing configures OpenTelemetry, by default from OTEL_* env with AppName as the service name.
+	Tracing tracing.Config
+	// Sentry configures error reporting, Dsn and Environment default to SENTRY_SERVER and ENVIRONMENT.
+	// Without Dsn Sentry is disabled.
+	Sentry sentry.ClientOptions
+	// QueryLog configures logging of SQL queries, slow queries are logged at warn level.
+	QueryLog app.QueryLogConfig
+	// HttpLog configures the access log: sampling rules, slow threshold and routes with logged bodies.
+	HttpLog HttpLoggerConfig
+	// Shutdown configures timeouts of graceful shutdown.
+	Shutdown ShutdownConfig
+	// Logging configures Logger, by default JSON (text in DEV) to stderr with LOG_LEVEL.
+	Logging logging.Config
+	// StandardLogger routes logrus.StandardLogger() of the whole process to Logger as well.
+	// By default only App.Log and the SDK components write to Logger, the standard logger is left untouched.
+	StandardLogger bool
 }
 
 func NewApplication(config ApplicationConfig) *Application {
 
-	if hasSentry {
-		sentry.ConfigureScope(func(scope *sentry.Scope) {
-			scope.SetExtra("application", config.AppName)
-		})
+	hasSentry = initSentry(config.Sentry, config.AppName)
+
+	slogger := logging.New(config.Logging)
+	logger := logging.NewLogrus(slogger)
+	if config.StandardLogger {
+		logging.UseSlog(log.StandardLogger(), slogger)
 	}
 
-	logger := log.New()
-	if strings.ToUpper(os.Getenv("ENVIRONMENT")) != "DEV" {
-		logger.Formatter = &log.JSONFormatter{}
+	if config.Tracing.ServiceName == "" {
+		config.Tracing.ServiceName = config.AppName
+	}
+	if config.Tracing.Environment == "" {
+		config.Tracing.Environment = os.Getenv("ENVIRONMENT")
+	}
+	stopTracing, err := tracing.Init(config.Tracing)
+	if err != nil {
+		panic(err)
 	}
-	log.SetOutput(logger.Writer())
 
-	dbConn := app.InitDb()
+	if config.QueryLog.Logger == nil {
+		config.QueryLog.Logger = logger
+	}
+	dbConn := app.InitDbWithQueryLog(config.QueryLog)
 	app.DbMigrate(config.MigrationPath, config.DbSchemaName)
 
+	if hasSentry {
+		dbConn.AddQueryHook(sentryQueryHook{})
+	}
+
+	// Статистика пула соединений: go_sql_open_connections, go_sql_wait_count_total и т.д.
+	if err := prometheus.Register(collectors.NewDBStatsCollector(dbConn.DB, os.Getenv("DB_NAME"))); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if !errors.As(err, &registered) {
+			panic(err)
+		}
+	}
+
 	if config.WhiteList == nil {
 		config.WhiteList = []string{}
 	}
 
+	redisClient := app.InitRedis()
+
+	if config.HmacCache.Redis == nil {
+		config.HmacCache.Redis = redisClient
+	}
+	if config.HmacCache.Prefix == "" {
+		config.HmacCache.Prefix = config.AppName
+	}
+	apiAccounts := NewCachedAccountResolver(NewHttpAccountResolver(os.Getenv("HMAC_SERVER")), config.HmacCache)
+	if config.Hmac.Resolver == nil {
+		config.Hmac.Resolver = apiAccounts
+	}
+	if config.Hmac.WhiteList == nil {
+		config.Hmac.WhiteList = config.WhiteList
+	}
+
+	if config.Jwt.Secret == "" && config.Jwt.JWKS == "" {
+		config.Jwt = auth.VerifierConfigFromEnv()
+	}
+	if config.Jwt.Revocations == nil {
+		if redisClient != nil {
+			config.Jwt.Revocations = auth.NewRedisRevocationList(redisClient, config.RevocationPrefix)
+		} else {
+			logger.Warn("redis is not configured, revoked access tokens are rejected only by this service")
+			config.Jwt.Revocations = auth.NewCachedRevocationList(auth.NewPgRevocationList(dbConn), 0)
+		}
+	}
+	jwtVerifier := auth.NewVerifier(config.Jwt)
+
+	if config.Auth.SigningKey == nil && config.Jwt.Secret != "" {
+		config.Auth.SigningKey = []byte(config.Jwt.Secret)
+	}
+	if config.Auth.Issuer == "" {
+		config.Auth.Issuer = config.Jwt.Issuer
+	}
+	if config.Auth.Audience == nil {
+		config.Auth.Audience = config.Jwt.Audience
+	}
+	var issuer *auth.Issuer
+	if config.Auth.SigningKey != nil {
+		issuer = auth.NewIssuer(config.Auth, auth.NewPgRefreshStore(dbConn), config.Jwt.Revocations)
+	}
+	if err := jwtVerifier.Refresh(context.Background()); err != nil {
+		logger.WithError(err).Warn("JWKS is not loaded, it will be retried in background")
+	}
+
+	if config.Policy.Roles == nil && config.Policy.Source == nil {
+		config.Policy.Source = auth.NewPgPolicySource(dbConn)
+	}
+	policy := auth.NewPolicy(config.Policy)
+	if err := policy.Refresh(context.Background()); err != nil {
+		logger.WithError(err).Warn("Permissions are not loaded, they will be retried in background")
+	}
+
+	var jobsBackend jobs.Backend
+	var locker lock.Locker
+	var scheduleLocker scheduler.Locker
+	var streamBroker stream.Broker
+	if redisClient != nil {
+		jobsBackend = jobs.NewRedisBackend(redisClient, config.AppName+":jobs", 0)
+		locker = lock.NewRedisLocker(redisClient, config.AppName)
+		scheduleLocker = scheduler.NewRedisLocker(redisClient)
+		streamBroker = stream.NewRedisBroker(redisClient, config.AppName+":stream")
+		if config.Idempotency.Store == nil {
+			config.Idempotency.Store = NewRedisIdempotencyStore(redisClient, config.AppName)
+		}
+		if config.Hmac.Nonces == nil {
+			config.Hmac.Nonces = NewRedisNonceStore(redisClient, config.AppName)
+		}
+		if config.RateLimit.Limiter == nil {
+			config.RateLimit.Limiter = ratelimit.NewRedisLimiter(redisClient, config.AppName, config.RateLimit.Algorithm)
+		}
+	} else {
+		logger.Warn("REDIS_HOST is not set, background jobs are stored in memory")
+		jobsBackend = jobs.NewMemoryBackend()
+		locker = lock.NewPgLocker(dbConn)
+		scheduleLocker = scheduler.NewPgLocker(dbConn)
+		if config.Idempotency.Store == nil {
+			config.Idempotency.Store = NewPgIdempotencyStore(dbConn)
+		}
+	}
+
+	shutdown := config.Shutdown.withDefaults()
+
 	App = &Application{
 		Db:      dbConn,
-		Router:  initRouter(logger, config.WhiteList...),
+		Router:  initRouter(logger, config, jwtVerifier),
+		Logger:  slogger,
 		Log:     logger,
 		Storage: app.InitStorage(),
+		Redis:   redisClient,
+		Jobs:    jobs.NewManager(jobsBackend, config.Jobs, logger),
+		Locker:  locker,
+
+		Scheduler:   scheduler.New(scheduleLocker, config.AppName, logger),
+		Stream:      stream.NewHub(streamBroker, config.Stream, logger),
+		ApiAccounts: apiAccounts,
+		Jwt:         jwtVerifier,
+		Auth:        issuer,
+		Policy:      policy,
+		Metrics:     metrics.NewRegistry(config.AppName, nil),
+		Health:      health.NewRegistry(),
+		Lifecycle:   lifecycle.NewWithConfig(lifecycle.Config{StopTimeout: shutdown.StopTimeout}),
+
+		shutdown: shutdown,
 	}
 
+	App.Router.Use(IdempotencyMiddleware(config.Idempotency))
+	if store, ok := config.Idempotency.Store.(*PgIdempotencyStore); ok {
+		App.Schedule("30 * * * *", "idempotency-keys-cleanup", store.Cleanup)
+	}
+	App.registerHealthChecks()
+	App.registerLifecycle(stopTracing)
+
 	return App
 }
 
+// Run serves until SIGINT or SIGTERM and exits the process if the server fails.
 func (a *Application) Run() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	if hasSentry {
-		defer sentry.Flush(time.Second * 5)
+	if err := a.RunContext(ctx); err != nil {
+		log.Fatalf("Ошибка сервера: %v\n", err)
 	}
+}
 
-	fmt.Println("Application is running")
-
-	a.AppendReadyProbe().AppendHealthProbe().AppendMetrics()
+// RunContext starts Lifecycle hooks and the server on HTTP_ADDR and shuts down gracefully when ctx is done:
+// readiness fails, after DrainPeriod the server stops accepting connections and waits for in-flight
+// requests, then hooks are stopped in reverse order (workers, telemetry, Redis and the DB pool last).
+func (a *Application) RunContext(ctx context.Context) error {
+	a.AppendReadyProbe().AppendHealthProbe().AppendMetrics().
+		AppendScheduleStatus().AppendApiAccountInvalidation().AppendPermissionExplain().AppendLogLevel()
 
-	done := make(chan bool)
+	if err := a.Lifecycle.Start(ctx); err != nil {
+		return err
+	}
 
 	srv := &http.Server{
 		Addr:    os.Getenv("HTTP_ADDR"),
 		Handler: a.Router,
 	}
+	if a.Stream != nil {
+		srv.RegisterOnShutdown(a.Stream.Close)
+	}
 
-	go func() {
-		log.Printf("Сервер запущен на %s\n", os.Getenv("HTTP_ADDR"))
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("Ошибка сервера при запуске: %v\n", err)
+	// Готовность выставляется только после того, как порт занят
+	listener := a.listener
+	if listener == nil {
+		addr := srv.Addr
+		if addr == "" {
+			addr = ":http"
 		}
+
+		var err error
+		if listener, err = net.Listen("tcp", addr); err != nil {
+			return errors.Join(err, a.stopLifecycle())
+		}
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Сервер запущен на %s\n", listener.Addr())
+		serveErr <- srv.Serve(listener)
 	}()
 
-	isReady.Store(true)
-	<-done
-	/* Grace full shutdown*/
-	quit := make(chan os.Signal, 1)
-	isReady.Store(false)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Println("Получен сигнал остановки. Завершение приложения...")
+	a.Health.SetServing(true)
+
+	var err error
+	select {
+	case <-ctx.Done():
+		log.Println("Получен сигнал остановки. Завершение приложения...")
+	case err = <-serveErr:
+		log.Printf("Сервер остановлен: %v\n", err)
+	}
+
+	a.Health.SetServing(false)
+
+	if err == nil {
+		// Балансировщик должен увидеть неготовность до закрытия порта
+		time.Sleep(a.shutdown.DrainPeriod)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), a.shutdown.ShutdownTimeout)
+		if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil {
+			err = fmt.Errorf("server shutdown: %w", shutdownErr)
+		}
+		cancel()
+	}
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Ошибка при остановке сервера: %v\n", err)
+	if stopErr := a.stopLifecycle(); stopErr != nil {
+		err = errors.Join(err, stopErr)
 	}
 
-	log.Println("Сервер успешно завершен")
+	if err == nil {
+		log.Println("Сервер успешно завершен")
+	}
+	return err
 }
 
 func (a *Application) AppendGetEndpoint(route string, handlers ...gin.HandlerFunc) *Application {
@@ -186,18 +425,138 @@ func (a *Application) AppendSwagger(prefix string) *Application {
 	return a
 }
 
+// AppendReadyProbe serves ReadinessProbe on /health/ready and the legacy /ready.
 func (a *Application) AppendReadyProbe() *Application {
-	a.AppendGetEndpoint(ReadyEndpoint, gin.WrapF(ReadyProbe(isReady)))
+	a.AppendGetEndpoint(HealthReadyEndpoint, ReadinessProbe(a.Health)).
+		AppendGetEndpoint(ReadyEndpoint, ReadinessProbe(a.Health))
 	return a
 }
 
+// AppendMetrics serves the default registry: Go runtime, DB pool, HTTP and InternalFetch RED metrics,
+// jobs, cache and metrics registered through a.Metrics.
 func (a *Application) AppendMetrics() *Application {
 	a.Router.GET(MetricsEndpoint, gin.WrapH(promhttp.Handler()))
 	return a
 }
 
+// AppendHealthProbe serves LiveProbe on /health/live and the overall status on /health.
+// Errors of checks may expose hosts and credentials, so the detailed HealthReport is served
+// on /admin/health, which is protected by HmacMiddleware.
 func (a *Application) AppendHealthProbe() *Application {
-	a.AppendGetEndpoint(HealthEndpoint, HealthProbe(a.Db))
+	a.AppendGetEndpoint(LiveEndpoint, LiveProbe()).
+		AppendGetEndpoint(HealthEndpoint, ReadinessProbe(a.Health)).
+		AppendGetEndpoint(HealthReportEndpoint, HealthReport(a.Health))
+	return a
+}
+
+// registerHealthChecks adds DB and Redis as critical checks, S3 and services from env as non-critical.
+func (a *Application) registerHealthChecks() {
+	a.Health.Register(health.Check{Name: "db", Check: health.Db(a.Db), Critical: true})
+
+	if a.Redis != nil {
+		a.Health.Register(health.Check{Name: "redis", Check: health.Redis(a.Redis), Critical: true})
+	}
+	if a.Storage != nil {
+		a.Health.Register(health.Check{Name: "storage", Check: health.Storage(a.Storage, "health")})
+	}
+
+	client := &http.Client{Transport: tracing.NewTransport(nil)}
+	for _, service := range []string{"USER_SERVER", "EVENT_SERVER", "HMAC_SERVER"} {
+		if url := os.Getenv(service); url != "" {
+			a.Health.Register(health.Check{
+				Name:     strings.ToLower(strings.TrimSuffix(service, "_SERVER")) + "-service",
+				Check:    health.Http(client, strings.TrimSuffix(url, "/")+ReadyEndpoint),
+				CacheTtl: 10 * time.Second,
+			})
+		}
+	}
+}
+
+// RegisterJob registers a typed background job handler on App.Jobs.
+//
+//	pkg.RegisterJob("user.welcome", func(ctx context.Context, p WelcomePayload) error { ... })
+//	pkg.App.Jobs.Enqueue(ctx, "user.welcome", WelcomePayload{UserId: 1}, jobs.WithDelay(time.Minute))
+func RegisterJob[T any](name string, handler func(ctx context.Context, payload T) error) {
+	jobs.Register[T](App.Jobs, name, handler)
+}
+
+// Schedule runs fn by a cron spec inside the service. Only one replica executes each tick.
+//
+//	app.Schedule("*/5 * * * *", "cleanup", func(ctx context.Context) error { ... })
+func (a *Application) Schedule(spec string, name string, fn scheduler.TaskFunc) *Application {
+	if err := a.Scheduler.Add(spec, name, fn); err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// AppendStream serves Server-Sent Events for authorized users, see stream.Hub.Handler.
+// Model events are delivered to users with the read permission of the model, e.g. "event.read"
+// or "event.read:own" for own models. Browsers can not sign requests, so add the route to ApplicationConfig.WhiteList.
+//
+//	app.AppendStream("/events", func(c *gin.Context, topic string) bool { return topic == "event" })
+func (a *Application) AppendStream(route string, authorize func(c *gin.Context, topic string) bool) *Application {
+	a.AppendGetEndpoint(route, AuthOnlyMiddleWare(), a.Stream.HandlerWithFilter(authorize, func(c *gin.Context, restriction stream.Restriction) bool {
+		var resource any
+		if restriction.OwnerId != 0 {
+			resource = streamOwner(restriction.OwnerId)
+		}
+		return Can(c, restriction.Permission, resource)
+	}))
+	return a
+}
+
+// streamOwner is the model of a stream event for "own" permissions, the model itself is only JSON.
+type streamOwner int64
+
+func (o streamOwner) OwnerId() int64 {
+	return int64(o)
+}
+
+// AppendScheduleStatus shows the state of scheduled tasks. The endpoint is protected by HmacMiddleware.
+func (a *Application) AppendScheduleStatus() *Application {
+	a.AppendGetEndpoint(ScheduleEndpoint, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"data": a.Scheduler.Status()})
+	})
+	return a
+}
+
+// AppendApiAccountInvalidation lets the HMAC service drop a cached account on all replicas,
+// e.g. after it was blocked. The endpoint is protected by HmacMiddleware and requires
+// ApiAccountInvalidatePermission, so other API accounts can not evict cached accounts.
+func (a *Application) AppendApiAccountInvalidation() *Application {
+	a.AppendPostEndpoint(ApiAccountInvalidateEndpoint, PermissionMiddleware(ApiAccountInvalidatePermission), func(c *gin.Context) {
+		if err := a.ApiAccounts.Invalidate(c, c.Param("key")); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+	return a
+}
+
+// AppendAuth mounts POST prefix/login, prefix/refresh and prefix/logout and schedules hourly
+// removal of expired refresh tokens. Browsers can not sign requests, so add the routes to ApplicationConfig.WhiteList.
+// The routes ignore an invalid or expired User-Jwt: it is sent exactly when the client needs a new token.
+//
+//	app.AppendAuth("/auth", users)
+func (a *Application) AppendAuth(prefix string, authenticator auth.Authenticator) *Application {
+	if a.Auth == nil {
+		panic("auth: signing key is not configured, set JWT_SECRET or ApplicationConfig.Auth")
+	}
+
+	if a.tokenOptionalRoutes == nil {
+		a.tokenOptionalRoutes = make(map[string]bool)
+	}
+	for _, route := range []string{"/login", "/refresh", "/logout"} {
+		a.tokenOptionalRoutes[http.MethodPost+" "+prefix+route] = true
+	}
+
+	a.AppendPostEndpoint(prefix+"/login", a.Auth.LoginHandler(authenticator)).
+		AppendPostEndpoint(prefix+"/refresh", a.Auth.RefreshHandler(authenticator)).
+		AppendPostEndpoint(prefix+"/logout", a.Auth.LogoutHandler()).
+		Schedule("0 * * * *", "auth-refresh-tokens-cleanup", a.Auth.Cleanup)
+
 	return a
 }
 
@@ -205,14 +564,38 @@ func (a *Application) GetRequestLogger(c *gin.Context) *log.Entry {
 	return a.Log.WithField(TraceIdContextKey, c.GetString(TraceIdContextKey))
 }
 
-func initRouter(logger *log.Logger, whiteList ...string) *gin.Engine {
-	r := gin.Default()
+func initRouter(logger *log.Logger, config ApplicationConfig, verifier *auth.Verifier) *gin.Engine {
+	// gin.Default добавил бы свой логгер, запросы пишет HttpLoggerWithConfig
+	r := gin.New()
+	// c передается в запросы к БД и InternalFetch как context.Context, так они получают span запроса
+	r.ContextWithFallback = true
+
+	if err := r.SetTrustedProxies(config.TrustedProxies); err != nil {
+		panic(err)
+	}
+
 	r.Use(TraceMiddleware()).
-		Use(HttpLogger(logger), gin.Recovery()).
-		Use(JsonMiddleware()).
-		Use(CorsMiddleware()).
-		Use(UserMiddleware()).
-		Use(HmacMiddleware(os.Getenv("HMAC_SERVER"), whiteList...))
+		Use(MetricsMiddleware()).
+		Use(HttpLoggerWithConfig(logger, config.HttpLog), gin.Recovery())
+
+	if hasSentry {
+		r.Use(SentryMiddleware())
+	}
+
+	r.Use(JsonMiddleware()).
+		Use(CorsMiddlewareWithConfig(config.Cors))
+
+	// Лимит по IP до проверки токена и подписи, иначе отклоненные запросы не ограничены
+	if !config.RateLimit.ipLimit().IsZero() {
+		r.Use(RateLimitIpMiddleware(config.RateLimit))
+	}
+
+	r.Use(UserMiddlewareWithVerifier(verifier)).
+		Use(HmacMiddlewareWithConfig(config.Hmac))
+
+	if config.RateLimit.enabled() {
+		r.Use(RateLimitMiddleware(config.RateLimit))
+	}
 
 	return r
 }
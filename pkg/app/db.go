@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/iteais/sdk/pkg/tracing"
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dialect/pgdialect"
 	"github.com/uptrace/bun/driver/pgdriver"
@@ -25,10 +26,17 @@ func getDbDsn() string {
 }
 
 func InitDb() *bun.DB {
+	return InitDbWithQueryLog(QueryLogConfig{})
+}
+
+// InitDbWithQueryLog connects to DB_* and logs queries with QueryLogHook.
+func InitDbWithQueryLog(config QueryLogConfig) *bun.DB {
 	dsn := getDbDsn()
 
 	sqldb := sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn)))
 	db := bun.NewDB(sqldb, pgdialect.New())
+	db.AddQueryHook(tracing.QueryHook{})
+	db.AddQueryHook(NewQueryLogHook(config))
 	return db
 }
 
@@ -0,0 +1,145 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/iteais/sdk/pkg/redact"
+	"github.com/iteais/sdk/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"github.com/uptrace/bun"
+)
+
+const defaultSlowQueryThreshold = 500 * time.Millisecond
+
+var (
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Duration of bun queries by operation (SELECT, INSERT, ...).",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation"})
+
+	queryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_query_errors_total",
+		Help: "Failed bun queries by operation, sql.ErrNoRows is not counted.",
+	}, []string{"operation"})
+)
+
+type QueryLogConfig struct {
+	// Logger defaults to the standard logrus logger.
+	Logger logrus.FieldLogger
+	// SlowThreshold defaults to DB_SLOW_QUERY_THRESHOLD (e.g. "200ms") or 500ms.
+	// Slower queries are logged at warn level, others at debug level.
+	SlowThreshold time.Duration
+	// Explain adds EXPLAIN of slow queries to the log. Nil means enabled in DEV only,
+	// an explicit false disables it in DEV too.
+	Explain *bool
+	// ShowParams disables redaction of string literals in logged queries, values matched by
+	// redact.Default patterns (emails, tokens) are still masked.
+	ShowParams bool
+}
+
+// QueryLogHook logs bun queries with duration, rows affected and the trace id of the request.
+type QueryLogHook struct {
+	config  QueryLogConfig
+	explain bool
+}
+
+var _ bun.QueryHook = (*QueryLogHook)(nil)
+
+func NewQueryLogHook(config QueryLogConfig) *QueryLogHook {
+	if config.Logger == nil {
+		config.Logger = logrus.StandardLogger()
+	}
+	if config.SlowThreshold == 0 {
+		config.SlowThreshold = defaultSlowQueryThreshold
+		if threshold, err := time.ParseDuration(os.Getenv("DB_SLOW_QUERY_THRESHOLD")); err == nil {
+			config.SlowThreshold = threshold
+		}
+	}
+	explain := strings.ToUpper(os.Getenv("ENVIRONMENT")) == "DEV"
+	if config.Explain != nil {
+		explain = *config.Explain
+	}
+	return &QueryLogHook{config: config, explain: explain}
+}
+
+func (h *QueryLogHook) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *QueryLogHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	operation := event.Operation()
+	duration := time.Since(event.StartTime)
+	queryDuration.WithLabelValues(operation).Observe(duration.Seconds())
+
+	fields := logrus.Fields{
+		"operation": operation,
+		"duration":  duration.Milliseconds(),
+		"query":     h.redact(event.Query),
+	}
+	if traceId := tracing.TraceId(ctx); traceId != "" {
+		fields["traceId"] = traceId
+	}
+	if event.Result != nil {
+		if rows, err := event.Result.RowsAffected(); err == nil {
+			fields["rows"] = rows
+		}
+	}
+	entry := h.config.Logger.WithFields(fields)
+
+	if event.Err != nil && !errors.Is(event.Err, sql.ErrNoRows) {
+		queryErrors.WithLabelValues(operation).Inc()
+		entry.WithField(logrus.ErrorKey, redact.Default.String(event.Err.Error())).Error("query failed")
+		return
+	}
+
+	if duration < h.config.SlowThreshold {
+		entry.Debug("query")
+		return
+	}
+
+	if h.explain && event.DB != nil {
+		if plan, err := explain(ctx, event.DB, event.Query); err == nil {
+			entry = entry.WithField("explain", h.redact(plan))
+		}
+	}
+	entry.Warn("slow query")
+}
+
+func (h *QueryLogHook) redact(query string) string {
+	if h.config.ShowParams {
+		return redact.Default.String(query)
+	}
+	return RedactQuery(query)
+}
+
+// RedactQuery replaces string literals with '?', numbers and identifiers are kept, see redact.Query.
+func RedactQuery(query string) string {
+	return redact.Query(query)
+}
+
+// explain uses database/sql directly: bun would treat ? in the query as placeholders and call hooks again.
+func explain(ctx context.Context, db *bun.DB, query string) (string, error) {
+	rows, err := db.DB.QueryContext(ctx, "EXPLAIN "+query)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), rows.Err()
+}
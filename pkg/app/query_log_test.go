@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+func newQueryLogDb(t *testing.T, config QueryLogConfig) (*bun.DB, *test.Hook) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	config.Logger = logger
+
+	sqldb, err := sql.Open(sqliteshim.ShimName, "file::memory:")
+	require.NoError(t, err)
+	sqldb.SetMaxOpenConns(1)
+
+	db := bun.NewDB(sqldb, sqlitedialect.New())
+	db.AddQueryHook(NewQueryLogHook(config))
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db, hook
+}
+
+func TestQueryLogHook(t *testing.T) {
+	db, hook := newQueryLogDb(t, QueryLogConfig{SlowThreshold: time.Hour})
+	ctx := context.Background()
+
+	_, err := db.ExecContext(ctx, "CREATE TABLE users (id INTEGER, email TEXT)")
+	require.NoError(t, err)
+	_, err = db.NewRaw("INSERT INTO users VALUES (?, ?)", 1, "john@example.com").Exec(ctx)
+	require.NoError(t, err)
+
+	entry := hook.LastEntry()
+	assert.Equal(t, logrus.DebugLevel, entry.Level)
+	assert.Equal(t, "INSERT INTO users VALUES (1, '?')", entry.Data["query"])
+	assert.Equal(t, int64(1), entry.Data["rows"])
+
+	var email string
+	err = db.NewRaw("SELECT email FROM users WHERE id = ?", 2).Scan(ctx, &email)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.Equal(t, logrus.DebugLevel, hook.LastEntry().Level)
+
+	_, err = db.ExecContext(ctx, "SELECT * FROM missing")
+	require.Error(t, err)
+	assert.Equal(t, logrus.ErrorLevel, hook.LastEntry().Level)
+	assert.Equal(t, "query failed", hook.LastEntry().Message)
+}
+
+func TestQueryLogHook_Slow(t *testing.T) {
+	db, hook := newQueryLogDb(t, QueryLogConfig{SlowThreshold: time.Nanosecond, ShowParams: true})
+
+	_, err := db.NewRaw("SELECT ?", "secret").Exec(context.Background())
+	require.NoError(t, err)
+
+	entry := hook.LastEntry()
+	assert.Equal(t, logrus.WarnLevel, entry.Level)
+	assert.Equal(t, "slow query", entry.Message)
+	assert.Equal(t, "SELECT 'secret'", entry.Data["query"])
+}
+
+func TestQueryLogHook_Explain(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "DEV")
+	disabled, enabled := false, true
+
+	assert.True(t, NewQueryLogHook(QueryLogConfig{}).explain)
+	assert.False(t, NewQueryLogHook(QueryLogConfig{Explain: &disabled}).explain)
+
+	t.Setenv("ENVIRONMENT", "PROD")
+	assert.False(t, NewQueryLogHook(QueryLogConfig{}).explain)
+	assert.True(t, NewQueryLogHook(QueryLogConfig{Explain: &enabled}).explain)
+}
+
+func TestRedactQuery(t *testing.T) {
+	assert.Equal(t, `SELECT * FROM "users" WHERE email = '?' AND name = '?' AND id = 5`,
+		RedactQuery(`SELECT * FROM "users" WHERE email = 'a@b.c' AND name = 'O''Brien' AND id = 5`))
+}
@@ -0,0 +1,28 @@
+package app
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/iteais/sdk/pkg/tracing"
+	"github.com/redis/go-redis/v9"
+)
+
+// InitRedis returns a client for REDIS_HOST:REDIS_PORT or nil if REDIS_HOST is not set.
+func InitRedis() *redis.Client {
+	host := os.Getenv("REDIS_HOST")
+	if host == "" {
+		return nil
+	}
+
+	db, _ := strconv.Atoi(os.Getenv("REDIS_DB"))
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     host + ":" + os.Getenv("REDIS_PORT"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+		DB:       db,
+	})
+	client.AddHook(tracing.RedisHook{})
+
+	return client
+}
@@ -3,6 +3,7 @@ package app
 import (
 	"os"
 
+	"github.com/iteais/sdk/pkg/tracing"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
@@ -13,9 +14,12 @@ func InitStorage() *minio.Client {
 	secretAccessKey := os.Getenv("S3_SECRET")
 	useSSL := false // Set to true if using HTTPS
 
+	transport, _ := minio.DefaultTransport(useSSL)
+
 	minioClient, _ := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKeyID, secretAccessKey, ""),
-		Secure: useSSL,
+		Creds:     credentials.NewStaticV4(accessKeyID, secretAccessKey, ""),
+		Secure:    useSSL,
+		Transport: tracing.NewTransport(transport),
 	})
 
 	return minioClient
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/models"
+)
+
+// Authenticator checks credentials of the login endpoint.
+type Authenticator interface {
+	UserLoader
+	// Authenticate returns ErrInvalidCredentials for an unknown login or a wrong password.
+	Authenticate(ctx context.Context, login string, password string) (models.User, []models.Role, error)
+}
+
+type LoginRequest struct {
+	Login    string `json:"login" binding:"required" example:"john@example.com"`
+	Password string `json:"password" binding:"required" example:"secret"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LoginHandler issues a token pair for valid credentials.
+func (i *Issuer) LoginHandler(authenticator Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req LoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+
+		user, roles, err := authenticator.Authenticate(c, req.Login, req.Password)
+		if errors.Is(err, ErrInvalidCredentials) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid login or password"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		i.respond(c, func() (*TokenPair, error) {
+			return i.Issue(c, user, roles)
+		})
+	}
+}
+
+// RefreshHandler exchanges a refresh token for a new token pair.
+func (i *Issuer) RefreshHandler(users UserLoader) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RefreshRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+
+		i.respond(c, func() (*TokenPair, error) {
+			return i.Refresh(c, req.RefreshToken, users)
+		})
+	}
+}
+
+// LogoutHandler revokes the refresh token family from the body and the access token from the request headers.
+func (i *Issuer) LogoutHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RefreshRequest
+		_ = c.ShouldBindJSON(&req)
+
+		if req.RefreshToken != "" {
+			if err := i.Revoke(c, req.RefreshToken); err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if accessToken := tokenFromRequest(c.Request, true); accessToken != "" {
+			if err := i.RevokeAccess(c, accessToken); err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func (i *Issuer) respond(c *gin.Context, issue func() (*TokenPair, error)) {
+	pair, err := issue()
+
+	switch {
+	case errors.Is(err, ErrInvalidRefreshToken), errors.Is(err, ErrRefreshTokenReused):
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Refresh token is invalid"})
+	case err != nil:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, gin.H{"data": pair})
+	}
+}
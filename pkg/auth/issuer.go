@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/iteais/sdk/pkg/models"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("auth: invalid refresh token")
+	// ErrRefreshTokenReused means a rotated token was presented again, the whole family is revoked.
+	ErrRefreshTokenReused = errors.New("auth: refresh token reused")
+	ErrInvalidCredentials = errors.New("auth: invalid credentials")
+)
+
+// AccessClaims are the claims of issued access tokens, the same that UserMiddleware reads.
+type AccessClaims struct {
+	User  *models.User  `json:"user,omitempty"`
+	Roles []models.Role `json:"roles"`
+	// Scope is a space separated list of scopes.
+	Scope string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (c AccessClaims) TokenId() string {
+	return c.ID
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// ExpiresIn is the access token lifetime in seconds.
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// UserLoader loads the current state of a user when tokens are refreshed.
+type UserLoader interface {
+	LoadUser(ctx context.Context, userId int64) (models.User, []models.Role, error)
+}
+
+type IssuerConfig struct {
+	// SigningMethod of access tokens. Default HS256.
+	SigningMethod jwt.SigningMethod
+	// SigningKey is []byte for HS* or crypto.Signer (*rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey).
+	SigningKey any
+	// Kid is put into the token header so verifiers can pick the key from JWKS.
+	Kid      string
+	Issuer   string
+	Audience []string
+	// AccessTTL default 15m.
+	AccessTTL time.Duration
+	// RefreshTTL default 30 days.
+	RefreshTTL time.Duration
+	// ReuseGrace allows a used refresh token to be exchanged again for this time, e.g. by a retry
+	// after a lost response or by two tabs refreshing at once. Later reuse revokes the family. Default 10s.
+	ReuseGrace time.Duration
+}
+
+// Issuer signs access tokens and rotates refresh tokens. Every login starts a family of refresh
+// tokens, each refresh replaces the token with a new one of the same family. A replaced token
+// presented again means it was stolen, so the whole family is revoked.
+type Issuer struct {
+	config      IssuerConfig
+	verifyKey   any
+	tokens      RefreshStore
+	revocations RevocationList
+}
+
+func NewIssuer(config IssuerConfig, tokens RefreshStore, revocations RevocationList) *Issuer {
+	if config.SigningMethod == nil {
+		config.SigningMethod = jwt.SigningMethodHS256
+	}
+	if config.AccessTTL <= 0 {
+		config.AccessTTL = 15 * time.Minute
+	}
+	if config.RefreshTTL <= 0 {
+		config.RefreshTTL = 30 * 24 * time.Hour
+	}
+	if config.ReuseGrace <= 0 {
+		config.ReuseGrace = 10 * time.Second
+	}
+
+	verifyKey := config.SigningKey
+	switch key := config.SigningKey.(type) {
+	case []byte:
+		if len(key) == 0 {
+			panic("auth: empty signing key")
+		}
+	case crypto.Signer:
+		verifyKey = key.Public()
+	default:
+		panic("auth: signing key must be []byte or crypto.Signer")
+	}
+
+	return &Issuer{config: config, verifyKey: verifyKey, tokens: tokens, revocations: revocations}
+}
+
+// Issue starts a new refresh token family for user, e.g. on login.
+func (i *Issuer) Issue(ctx context.Context, user models.User, roles []models.Role) (*TokenPair, error) {
+	return i.issue(ctx, user, roles, uuid.NewString())
+}
+
+// Refresh rotates refreshToken and issues tokens with the current user and roles from users.
+func (i *Issuer) Refresh(ctx context.Context, refreshToken string, users UserLoader) (*TokenPair, error) {
+	hash := hashToken(refreshToken)
+
+	token, err := i.tokens.Find(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if token.RevokedAt != nil || now.After(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Пользователя загружаем до обмена, чтобы ошибка загрузки не сжигала токен
+	user, roles, err := users.LoadUser(ctx, token.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.UsedAt == nil {
+		ok, err := i.tokens.Use(ctx, hash, now)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return i.issue(ctx, user, roles, token.FamilyId)
+		}
+
+		// Токен обменял параллельный запрос
+		if token, err = i.tokens.Find(ctx, hash); err != nil {
+			return nil, err
+		}
+		if token.RevokedAt != nil {
+			return nil, ErrInvalidRefreshToken
+		}
+	}
+
+	// Повтор в пределах ReuseGrace: клиент не получил ответ или две вкладки обновляют токен одновременно
+	if token.UsedAt != nil && now.Sub(*token.UsedAt) <= i.config.ReuseGrace {
+		return i.issue(ctx, user, roles, token.FamilyId)
+	}
+
+	// Токен уже обменян: его украли или два запроса пришли с одним токеном
+	if err = i.tokens.RevokeFamily(ctx, token.FamilyId, now); err != nil {
+		return nil, err
+	}
+
+	return nil, ErrRefreshTokenReused
+}
+
+// Revoke revokes the family of refreshToken, e.g. on logout. Unknown tokens are ignored.
+func (i *Issuer) Revoke(ctx context.Context, refreshToken string) error {
+	token, err := i.tokens.Find(ctx, hashToken(refreshToken))
+	if errors.Is(err, ErrInvalidRefreshToken) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return i.tokens.RevokeFamily(ctx, token.FamilyId, time.Now())
+}
+
+// RevokeAccess adds the id of an access token issued by i to the revocation list until it expires.
+// Invalid and expired tokens are ignored.
+func (i *Issuer) RevokeAccess(ctx context.Context, accessToken string) error {
+	var claims AccessClaims
+	_, err := jwt.ParseWithClaims(accessToken, &claims, func(*jwt.Token) (any, error) {
+		return i.verifyKey, nil
+	}, jwt.WithValidMethods([]string{i.config.SigningMethod.Alg()}))
+	if err != nil || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+
+	return i.revocations.Revoke(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// Cleanup deletes expired refresh tokens and expired revoked access tokens, see Application.AppendAuth.
+func (i *Issuer) Cleanup(ctx context.Context) error {
+	now := time.Now()
+	_, err := i.tokens.DeleteExpired(ctx, now)
+
+	if revocations, ok := i.revocations.(ExpiringRevocationList); ok {
+		_, revocationsErr := revocations.DeleteExpired(ctx, now)
+		err = errors.Join(err, revocationsErr)
+	}
+
+	return err
+}
+
+func (i *Issuer) issue(ctx context.Context, user models.User, roles []models.Role, familyId string) (*TokenPair, error) {
+	now := time.Now()
+
+	claims := AccessClaims{
+		User:  &user,
+		Roles: roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   strconv.FormatInt(user.ID, 10),
+			Issuer:    i.config.Issuer,
+			Audience:  i.config.Audience,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(i.config.AccessTTL)),
+		},
+	}
+
+	token := jwt.NewWithClaims(i.config.SigningMethod, claims)
+	if i.config.Kid != "" {
+		token.Header["kid"] = i.config.Kid
+	}
+
+	accessToken, err := token.SignedString(i.config.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, err
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(secret)
+
+	err = i.tokens.Create(ctx, &RefreshToken{
+		Hash:      hashToken(refreshToken),
+		FamilyId:  familyId,
+		UserId:    user.ID,
+		ExpiresAt: now.Add(i.config.RefreshTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(i.config.AccessTTL.Seconds()),
+	}, nil
+}
+
+// hashToken refresh tokens are stored only as sha256, a database leak does not expose them.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
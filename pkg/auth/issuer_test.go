@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/iteais/sdk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+type testUsers struct{}
+
+func (testUsers) LoadUser(_ context.Context, userId int64) (models.User, []models.Role, error) {
+	return models.User{ID: userId, Email: "john@example.com", Password: "hash"}, []models.Role{{Id: 1, Title: "admin"}}, nil
+}
+
+func (u testUsers) Authenticate(ctx context.Context, login string, password string) (models.User, []models.Role, error) {
+	if login != "john@example.com" || password != "secret" {
+		return models.User{}, nil, ErrInvalidCredentials
+	}
+	return u.LoadUser(ctx, 7)
+}
+
+func newTestIssuer(store RefreshStore) (*Issuer, *Verifier) {
+	revocations := NewMemoryRevocationList()
+	issuer := NewIssuer(IssuerConfig{SigningKey: []byte("secret"), Issuer: "auth"}, store, revocations)
+	verifier := NewVerifier(VerifierConfig{Secret: "secret", Issuer: "auth", Revocations: revocations})
+	return issuer, verifier
+}
+
+func TestIssuer_Claims(t *testing.T) {
+	issuer, verifier := newTestIssuer(NewMemoryRefreshStore())
+	ctx := context.Background()
+
+	user, roles, _ := testUsers{}.LoadUser(ctx, 7)
+	pair, err := issuer.Issue(ctx, user, roles)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer", pair.TokenType)
+	assert.EqualValues(t, 900, pair.ExpiresIn)
+
+	token, err := verifier.Verify(ctx, pair.AccessToken)
+	require.NoError(t, err)
+
+	claims := token.Claims.(jwt.MapClaims)
+	assert.Equal(t, "7", claims["sub"])
+	assert.Equal(t, "john@example.com", claims["user"].(map[string]any)["email"])
+	assert.NotContains(t, claims["user"], "Password")
+	assert.Equal(t, "admin", claims["roles"].([]any)[0].(map[string]any)["title"])
+}
+
+func TestIssuer_Asymmetric(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	issuer := NewIssuer(IssuerConfig{SigningMethod: jwt.SigningMethodEdDSA, SigningKey: private, Kid: "ed"}, NewMemoryRefreshStore(), NewMemoryRevocationList())
+
+	server := newJwksServer(edJWK("ed", public))
+	defer server.Close()
+
+	verifier := NewVerifier(VerifierConfig{JWKS: server.URL})
+	require.NoError(t, verifier.Refresh(context.Background()))
+
+	pair, err := issuer.Issue(context.Background(), models.User{ID: 1}, nil)
+	require.NoError(t, err)
+
+	_, err = verifier.Verify(context.Background(), pair.AccessToken)
+	assert.NoError(t, err)
+}
+
+func TestIssuer_Rotation(t *testing.T) {
+	for name, store := range map[string]RefreshStore{"memory": NewMemoryRefreshStore(), "sql": newSqlStore(t)} {
+		t.Run(name, func(t *testing.T) {
+			issuer, _ := newTestIssuer(store)
+			issuer.config.ReuseGrace = time.Millisecond
+			ctx := context.Background()
+
+			first, err := issuer.Issue(ctx, models.User{ID: 7}, nil)
+			require.NoError(t, err)
+
+			second, err := issuer.Refresh(ctx, first.RefreshToken, testUsers{})
+			require.NoError(t, err)
+			assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+			third, err := issuer.Refresh(ctx, second.RefreshToken, testUsers{})
+			require.NoError(t, err)
+			time.Sleep(5 * time.Millisecond)
+
+			// The first token was stolen and used again, the whole family is revoked
+			_, err = issuer.Refresh(ctx, first.RefreshToken, testUsers{})
+			assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+			_, err = issuer.Refresh(ctx, third.RefreshToken, testUsers{})
+			assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+			_, err = issuer.Refresh(ctx, "unknown", testUsers{})
+			assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+			// Another login is not affected
+			other, err := issuer.Issue(ctx, models.User{ID: 7}, nil)
+			require.NoError(t, err)
+			_, err = issuer.Refresh(ctx, other.RefreshToken, testUsers{})
+			assert.NoError(t, err)
+		})
+	}
+}
+
+type failingUsers struct{}
+
+func (failingUsers) LoadUser(context.Context, int64) (models.User, []models.Role, error) {
+	return models.User{}, nil, sql.ErrConnDone
+}
+
+func TestIssuer_RefreshRetry(t *testing.T) {
+	issuer, _ := newTestIssuer(NewMemoryRefreshStore())
+	ctx := context.Background()
+
+	pair, err := issuer.Issue(ctx, models.User{ID: 7}, nil)
+	require.NoError(t, err)
+
+	// Ошибка загрузки пользователя не сжигает токен
+	_, err = issuer.Refresh(ctx, pair.RefreshToken, failingUsers{})
+	assert.ErrorIs(t, err, sql.ErrConnDone)
+
+	first, err := issuer.Refresh(ctx, pair.RefreshToken, testUsers{})
+	require.NoError(t, err)
+
+	// Повтор в пределах ReuseGrace не отзывает семейство
+	second, err := issuer.Refresh(ctx, pair.RefreshToken, testUsers{})
+	require.NoError(t, err)
+
+	_, err = issuer.Refresh(ctx, first.RefreshToken, testUsers{})
+	assert.NoError(t, err)
+	_, err = issuer.Refresh(ctx, second.RefreshToken, testUsers{})
+	assert.NoError(t, err)
+}
+
+func TestIssuer_Expired(t *testing.T) {
+	store := NewMemoryRefreshStore()
+	issuer, _ := newTestIssuer(store)
+	issuer.config.RefreshTTL = time.Millisecond
+	ctx := context.Background()
+
+	pair, err := issuer.Issue(ctx, models.User{ID: 7}, nil)
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	_, err = issuer.Refresh(ctx, pair.RefreshToken, testUsers{})
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	require.NoError(t, issuer.Cleanup(ctx))
+	_, err = store.Find(ctx, hashToken(pair.RefreshToken))
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestIssuer_CleanupRevocations(t *testing.T) {
+	revocations := NewCachedRevocationList(NewPgRevocationList(newSqlDb(t)), 0)
+	issuer := NewIssuer(IssuerConfig{SigningKey: []byte("secret")}, NewMemoryRefreshStore(), revocations)
+	ctx := context.Background()
+
+	require.NoError(t, revocations.Revoke(ctx, "expired", time.Now().Add(time.Millisecond)))
+	require.NoError(t, revocations.Revoke(ctx, "active", time.Now().Add(time.Hour)))
+	time.Sleep(5 * time.Millisecond)
+
+	require.NoError(t, issuer.Cleanup(ctx))
+
+	deleted, err := revocations.DeleteExpired(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	revoked, err := revocations.IsRevoked(ctx, "active")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestIssuer_Endpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	issuer, verifier := newTestIssuer(NewMemoryRefreshStore())
+
+	r := gin.New()
+	r.POST("/auth/login", issuer.LoginHandler(testUsers{}))
+	r.POST("/auth/refresh", issuer.RefreshHandler(testUsers{}))
+	r.POST("/auth/logout", issuer.LogoutHandler())
+
+	call := func(path string, body string, accessToken string) (*httptest.ResponseRecorder, TokenPair) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var resp struct {
+			Data TokenPair `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp.Data
+	}
+
+	w, _ := call("/auth/login", `{"login":"john@example.com","password":"wrong"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w, _ = call("/auth/login", `{"login":"john@example.com"}`, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w, pair := call("/auth/login", `{"login":"john@example.com","password":"secret"}`, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	w, pair = call("/auth/refresh", `{"refresh_token":"`+pair.RefreshToken+`"}`, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	_, err := verifier.Verify(context.Background(), pair.AccessToken)
+	require.NoError(t, err)
+
+	w, _ = call("/auth/logout", `{"refresh_token":"`+pair.RefreshToken+`"}`, pair.AccessToken)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	_, err = verifier.Verify(context.Background(), pair.AccessToken)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+
+	w, _ = call("/auth/refresh", `{"refresh_token":"`+pair.RefreshToken+`"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestPgRevocationList(t *testing.T) {
+	revocations := NewPgRevocationList(newSqlDb(t))
+	ctx := context.Background()
+
+	require.NoError(t, revocations.Revoke(ctx, "active", time.Now().Add(time.Hour)))
+	require.NoError(t, revocations.Revoke(ctx, "active", time.Now().Add(time.Hour)))
+	require.NoError(t, revocations.Revoke(ctx, "expired", time.Now().Add(-time.Hour)))
+
+	revoked, err := revocations.IsRevoked(ctx, "active")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, _ = revocations.IsRevoked(ctx, "expired")
+	assert.False(t, revoked)
+
+	deleted, err := revocations.DeleteExpired(ctx, time.Now())
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, deleted)
+}
+
+func TestPgRevocationListInitSurvivesCanceledRequest(t *testing.T) {
+	revocations := NewPgRevocationList(newSqlDb(t))
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := revocations.IsRevoked(canceled, "id")
+	require.ErrorIs(t, err, context.Canceled)
+
+	require.NoError(t, revocations.Revoke(context.Background(), "id", time.Now().Add(time.Hour)))
+	revoked, err := revocations.IsRevoked(context.Background(), "id")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func newSqlDb(t *testing.T) *bun.DB {
+	sqldb, err := sql.Open(sqliteshim.ShimName, "file::memory:")
+	require.NoError(t, err)
+	sqldb.SetMaxOpenConns(1)
+
+	db := bun.NewDB(sqldb, sqlitedialect.New())
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+func newSqlStore(t *testing.T) RefreshStore {
+	return NewPgRefreshStore(newSqlDb(t))
+}
@@ -0,0 +1,369 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iteais/sdk/pkg/models"
+	"github.com/sirupsen/logrus"
+	"github.com/uptrace/bun"
+)
+
+// OwnCondition limits a grant to resources of the user, e.g. "event.update:own".
+// The resource must implement models.ModelOwned.
+const OwnCondition = "own"
+
+// ConditionFunc checks a conditional grant against the loaded resource.
+type ConditionFunc func(p *Principal, resource any) (bool, string)
+
+// QueryConditionFunc limits query to resources meeting a conditional grant, model is the model of query.
+// It returns false and the reason if the condition can not be applied to the query.
+type QueryConditionFunc func(p *Principal, query *bun.SelectQuery, model any) (bool, string)
+
+// PolicySource loads permissions of roles, e.g. from the database.
+type PolicySource interface {
+	LoadPolicy(ctx context.Context) (map[string][]string, error)
+}
+
+type PolicyConfig struct {
+	// Roles maps a role title (user roles and ApiAccount.Role) to permissions like "user.read",
+	// "event.update:own", "event.*" or "*".
+	Roles map[string][]string
+	// Source replaces Roles on every refresh when set.
+	Source PolicySource
+	// RefreshInterval of Source. Default 1m.
+	RefreshInterval time.Duration
+}
+
+// Decision explains the result of a permission check.
+type Decision struct {
+	Allowed    bool     `json:"allowed"`
+	Permission string   `json:"permission"`
+	Roles      []string `json:"roles"`
+	// Grant is the matched grant of Role, e.g. "event.update:own".
+	Grant  string `json:"grant,omitempty"`
+	Role   string `json:"role,omitempty"`
+	Reason string `json:"reason"`
+	// Conditional is true when only conditional grants match and no resource was given yet.
+	Conditional bool `json:"conditional,omitempty"`
+}
+
+type grant struct {
+	pattern   string
+	condition string
+	raw       string
+}
+
+// Policy maps roles to permissions and checks them for principals.
+type Policy struct {
+	config     PolicyConfig
+	mu         sync.RWMutex
+	roles      map[string][]grant
+	conditions map[string]ConditionFunc
+	// queryConditions применяют условия к запросу списка, см. Scope
+	queryConditions map[string]QueryConditionFunc
+}
+
+func NewPolicy(config PolicyConfig) *Policy {
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = time.Minute
+	}
+
+	p := &Policy{
+		config:          config,
+		conditions:      map[string]ConditionFunc{OwnCondition: ownCondition},
+		queryConditions: map[string]QueryConditionFunc{OwnCondition: ownQueryCondition},
+	}
+	p.Set(config.Roles)
+
+	return p
+}
+
+// Set replaces permissions of all roles.
+func (p *Policy) Set(roles map[string][]string) {
+	parsed := make(map[string][]grant, len(roles))
+	for role, permissions := range roles {
+		for _, permission := range permissions {
+			pattern, condition, _ := strings.Cut(permission, ":")
+			parsed[role] = append(parsed[role], grant{pattern: pattern, condition: condition, raw: permission})
+		}
+	}
+
+	p.mu.Lock()
+	p.roles = parsed
+	p.mu.Unlock()
+}
+
+// Condition registers a custom condition used as "resource.action:name".
+func (p *Policy) Condition(name string, fn ConditionFunc) *Policy {
+	p.mu.Lock()
+	p.conditions[name] = fn
+	p.mu.Unlock()
+	return p
+}
+
+// QueryCondition registers the query form of a custom condition used by Scope.
+func (p *Policy) QueryCondition(name string, fn QueryConditionFunc) *Policy {
+	p.mu.Lock()
+	p.queryConditions[name] = fn
+	p.mu.Unlock()
+	return p
+}
+
+// Refresh loads permissions from Source.
+func (p *Policy) Refresh(ctx context.Context) error {
+	if p.config.Source == nil {
+		return nil
+	}
+
+	roles, err := p.config.Source.LoadPolicy(ctx)
+	if err != nil {
+		return err
+	}
+
+	p.Set(roles)
+	return nil
+}
+
+// Start refreshes permissions from Source every RefreshInterval until ctx is done.
+func (p *Policy) Start(ctx context.Context) {
+	if p.config.Source == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(p.config.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := p.Refresh(ctx); err != nil {
+					logrus.WithError(err).Warn("auth: policy refresh failed")
+				}
+			}
+		}
+	}()
+}
+
+// Can reports whether principal has permission on resource. resource may be nil for checks
+// without a loaded model, then conditional grants are not enough.
+func (p *Policy) Can(principal *Principal, permission string, resource any) bool {
+	return p.Explain(principal, permission, resource).Allowed
+}
+
+// Explain checks permission and tells which grant allowed it or why it was denied.
+// With a nil resource conditional grants only mark the decision as Conditional.
+func (p *Policy) Explain(principal *Principal, permission string, resource any) Decision {
+	decision := Decision{Permission: permission, Roles: principalRoles(principal)}
+
+	if principal == nil || (principal.User == nil && principal.ApiAccount == nil) {
+		decision.Reason = "not authenticated"
+		return decision
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var failed []string
+	for _, role := range decision.Roles {
+		for _, g := range p.roles[role] {
+			if !matchPermission(g.pattern, permission) {
+				continue
+			}
+
+			if g.condition == "" {
+				decision.Allowed, decision.Role, decision.Grant = true, role, g.raw
+				decision.Reason = fmt.Sprintf("role %s grants %s", role, g.raw)
+				return decision
+			}
+
+			if resource == nil {
+				decision.Conditional, decision.Role, decision.Grant = true, role, g.raw
+				continue
+			}
+
+			condition, ok := p.conditions[g.condition]
+			if !ok {
+				failed = append(failed, fmt.Sprintf("%s: unknown condition %s", g.raw, g.condition))
+				continue
+			}
+
+			if ok, reason := condition(principal, resource); !ok {
+				failed = append(failed, fmt.Sprintf("%s: %s", g.raw, reason))
+				continue
+			}
+
+			decision.Allowed, decision.Role, decision.Grant = true, role, g.raw
+			decision.Reason = fmt.Sprintf("role %s grants %s", role, g.raw)
+			return decision
+		}
+	}
+
+	switch {
+	case decision.Conditional:
+		decision.Reason = fmt.Sprintf("role %s grants %s, the condition is checked on the loaded resource", decision.Role, decision.Grant)
+	case len(failed) > 0:
+		decision.Reason = "conditions are not met: " + strings.Join(failed, "; ")
+	default:
+		decision.Reason = fmt.Sprintf("no role of [%s] grants %s", strings.Join(decision.Roles, ", "), permission)
+	}
+
+	return decision
+}
+
+// Scope limits query to resources allowed for principal by permission, e.g. to own events for
+// "event.read:own". Unconditional grants leave query as is. Conditional grants are joined with OR;
+// the decision is denied if none of them can be applied to the query.
+func (p *Policy) Scope(principal *Principal, permission string, query *bun.SelectQuery, model any) Decision {
+	decision := p.Explain(principal, permission, nil)
+	if decision.Allowed || !decision.Conditional {
+		return decision
+	}
+	decision.Conditional = false
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var failed []string
+	query.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+		for _, role := range decision.Roles {
+			for _, g := range p.roles[role] {
+				if g.condition == "" || !matchPermission(g.pattern, permission) {
+					continue
+				}
+
+				condition, ok := p.queryConditions[g.condition]
+				if !ok {
+					failed = append(failed, fmt.Sprintf("%s: condition %s can not be applied to a query", g.raw, g.condition))
+					continue
+				}
+
+				q.WhereGroup(" OR ", func(q *bun.SelectQuery) *bun.SelectQuery {
+					if ok, reason := condition(principal, q, model); !ok {
+						failed = append(failed, fmt.Sprintf("%s: %s", g.raw, reason))
+					} else if !decision.Allowed {
+						decision.Allowed, decision.Role, decision.Grant = true, role, g.raw
+					}
+					return q
+				})
+			}
+		}
+		return q
+	})
+
+	if decision.Allowed {
+		decision.Reason = fmt.Sprintf("role %s grants %s, the query is limited by the condition", decision.Role, decision.Grant)
+	} else {
+		decision.Role, decision.Grant = "", ""
+		decision.Reason = "conditions are not met: " + strings.Join(failed, "; ")
+	}
+
+	return decision
+}
+
+func principalRoles(principal *Principal) []string {
+	roles := make([]string, 0)
+	if principal == nil {
+		return roles
+	}
+	for _, role := range principal.Roles {
+		roles = append(roles, role.Title)
+	}
+	if principal.ApiAccount != nil && principal.ApiAccount.Role != "" {
+		roles = append(roles, principal.ApiAccount.Role)
+	}
+	return roles
+}
+
+// matchPermission matches "event.update" by "event.update", "event.*" and "*".
+func matchPermission(pattern string, permission string) bool {
+	if pattern == "*" || pattern == permission {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(permission, prefix)
+	}
+	return false
+}
+
+func ownCondition(p *Principal, resource any) (bool, string) {
+	owned, ok := resource.(models.ModelOwned)
+	if !ok {
+		return false, fmt.Sprintf("%T does not implement models.ModelOwned", resource)
+	}
+	if p.User == nil {
+		return false, "no user in token"
+	}
+	if owned.OwnerId() != p.User.ID {
+		return false, fmt.Sprintf("owner %d is not user %d", owned.OwnerId(), p.User.ID)
+	}
+	return true, ""
+}
+
+func ownQueryCondition(p *Principal, query *bun.SelectQuery, model any) (bool, string) {
+	owned, ok := model.(models.ModelOwnerColumn)
+	if !ok {
+		return false, fmt.Sprintf("%T does not implement models.ModelOwnerColumn", model)
+	}
+	if p.User == nil {
+		return false, "no user in token"
+	}
+	query.Where("?TableAlias.? = ?", bun.Ident(owned.OwnerColumn()), p.User.ID)
+	return true, ""
+}
+
+type rolePermission struct {
+	bun.BaseModel `bun:"table:sdk_role_permissions"`
+
+	Role       string `bun:",pk"`
+	Permission string `bun:",pk"`
+}
+
+// PgPolicySource loads permissions from the sdk_role_permissions (role, permission) table, created on first use.
+type PgPolicySource struct {
+	db     *bun.DB
+	initMu sync.Mutex
+	inited bool
+}
+
+func NewPgPolicySource(db *bun.DB) *PgPolicySource {
+	return &PgPolicySource{db: db}
+}
+
+// init creates the table, a failed attempt is retried by the next LoadPolicy.
+func (s *PgPolicySource) init(ctx context.Context) error {
+	s.initMu.Lock()
+	defer s.initMu.Unlock()
+	if s.inited {
+		return nil
+	}
+
+	if _, err := s.db.NewCreateTable().Model((*rolePermission)(nil)).IfNotExists().Exec(context.WithoutCancel(ctx)); err != nil {
+		return err
+	}
+	s.inited = true
+	return nil
+}
+
+func (s *PgPolicySource) LoadPolicy(ctx context.Context) (map[string][]string, error) {
+	if err := s.init(ctx); err != nil {
+		return nil, err
+	}
+
+	var rows []rolePermission
+	if err := s.db.NewSelect().Model(&rows).Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string][]string)
+	for _, row := range rows {
+		roles[row.Role] = append(roles[row.Role], row.Permission)
+	}
+	return roles, nil
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iteais/sdk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+func userPrincipal(id int64, roles ...string) *Principal {
+	p := &Principal{User: &models.User{ID: id}}
+	for _, role := range roles {
+		p.Roles = append(p.Roles, models.Role{Title: role})
+	}
+	return p
+}
+
+func TestPolicy_Explain(t *testing.T) {
+	policy := NewPolicy(PolicyConfig{Roles: map[string][]string{
+		"admin":   {"*"},
+		"editor":  {"event.*", "user.read"},
+		"user":    {"event.read", "event.update:own"},
+		"service": {"user.read"},
+	}})
+
+	own := models.Event{CreatedBy: 7}
+	foreign := models.Event{CreatedBy: 8}
+
+	tests := []struct {
+		name        string
+		principal   *Principal
+		permission  string
+		resource    any
+		allowed     bool
+		conditional bool
+	}{
+		{"anonymous", nil, "event.read", nil, false, false},
+		{"admin wildcard", userPrincipal(1, "admin"), "user.delete", nil, true, false},
+		{"prefix wildcard", userPrincipal(1, "editor"), "event.delete", nil, true, false},
+		{"prefix does not match other resource", userPrincipal(1, "editor"), "user.update", nil, false, false},
+		{"plain grant", userPrincipal(7, "user"), "event.read", nil, true, false},
+		{"own without resource", userPrincipal(7, "user"), "event.update", nil, false, true},
+		{"own resource", userPrincipal(7, "user"), "event.update", own, true, false},
+		{"foreign resource", userPrincipal(7, "user"), "event.update", foreign, false, false},
+		{"not owned model", userPrincipal(7, "user"), "event.update", models.User{ID: 7}, false, false},
+		{"no roles", userPrincipal(7), "event.read", nil, false, false},
+		{"api account role", &Principal{ApiAccount: &models.ApiAccount{Role: "service"}}, "user.read", nil, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := policy.Explain(tt.principal, tt.permission, tt.resource)
+			assert.Equal(t, tt.allowed, decision.Allowed, decision.Reason)
+			assert.Equal(t, tt.conditional, decision.Conditional, decision.Reason)
+			assert.NotEmpty(t, decision.Reason)
+		})
+	}
+
+	decision := policy.Explain(userPrincipal(7, "user"), "event.update", foreign)
+	assert.Contains(t, decision.Reason, "owner 8 is not user 7")
+}
+
+func TestPolicy_Condition(t *testing.T) {
+	policy := NewPolicy(PolicyConfig{Roles: map[string][]string{"user": {"event.read:visible"}}}).
+		Condition("visible", func(_ *Principal, resource any) (bool, string) {
+			return resource.(*models.Event).Visible, "event is hidden"
+		})
+
+	assert.True(t, policy.Can(userPrincipal(1, "user"), "event.read", &models.Event{Visible: true}))
+	assert.False(t, policy.Can(userPrincipal(1, "user"), "event.read", &models.Event{}))
+}
+
+func TestPolicy_Scope(t *testing.T) {
+	db := newSqlDb(t)
+	policy := NewPolicy(PolicyConfig{Roles: map[string][]string{
+		"admin":  {"event.*"},
+		"user":   {"event.read:own", "event.read:visible"},
+		"hidden": {"event.read:visible"},
+	}}).QueryCondition("visible", func(_ *Principal, query *bun.SelectQuery, _ any) (bool, string) {
+		query.Where("visible")
+		return true, ""
+	})
+
+	scope := func(principal *Principal) (Decision, string) {
+		query := db.NewSelect().Model((*models.Event)(nil))
+		decision := policy.Scope(principal, "event.read", query, new(models.Event))
+		return decision, query.String()
+	}
+
+	decision, sql := scope(userPrincipal(1, "admin"))
+	assert.True(t, decision.Allowed)
+	assert.NotContains(t, sql, "WHERE")
+
+	decision, sql = scope(userPrincipal(7, "user"))
+	assert.True(t, decision.Allowed, decision.Reason)
+	assert.Contains(t, sql, `WHERE ((("event"."created_by" = 7)) OR ((visible)))`)
+
+	decision, _ = scope(userPrincipal(7))
+	assert.False(t, decision.Allowed)
+
+	decision, _ = scope(&Principal{ApiAccount: &models.ApiAccount{Role: "user"}})
+	assert.True(t, decision.Allowed, decision.Reason)
+
+	policy.Set(map[string][]string{"user": {"event.read:unknown"}})
+	decision, _ = scope(userPrincipal(7, "user"))
+	assert.False(t, decision.Allowed)
+	assert.Contains(t, decision.Reason, "can not be applied to a query")
+}
+
+func TestPgPolicySource(t *testing.T) {
+	db := newSqlDb(t)
+	source := NewPgPolicySource(db)
+	ctx := context.Background()
+
+	_, err := source.LoadPolicy(ctx)
+	require.NoError(t, err)
+
+	_, err = db.NewInsert().Model(&[]rolePermission{
+		{Role: "user", Permission: "event.read"},
+		{Role: "user", Permission: "event.update:own"},
+	}).Exec(ctx)
+	require.NoError(t, err)
+
+	policy := NewPolicy(PolicyConfig{Source: source})
+	assert.False(t, policy.Can(userPrincipal(1, "user"), "event.read", nil))
+
+	require.NoError(t, policy.Refresh(ctx))
+	assert.True(t, policy.Can(userPrincipal(1, "user"), "event.read", nil))
+	assert.True(t, policy.Explain(userPrincipal(1, "user"), "event.update", nil).Conditional)
+}
+
+func TestPgPolicySourceRetriesInit(t *testing.T) {
+	source := NewPgPolicySource(newSqlDb(t))
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := source.LoadPolicy(canceled)
+	require.ErrorIs(t, err, context.Canceled)
+
+	roles, err := source.LoadPolicy(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, roles)
+}
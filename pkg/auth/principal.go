@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/iteais/sdk/pkg/models"
+)
+
+// Principal is the authenticated caller of a request: a user from User-Jwt and/or an api account
+// verified by HmacMiddleware.
+type Principal struct {
+	User       *models.User
+	Roles      []models.Role
+	ApiAccount *models.ApiAccount
+	// TokenId is the jti of the user token.
+	TokenId string
+	// Scopes from the space separated "scope" claim.
+	Scopes []string
+	// Claims are the verified user token claims, *AccessClaims or a custom type, see pkg.CurrentClaims.
+	Claims jwt.Claims
+}
+
+// PrincipalClaims are claims which describe a principal. Custom claims usually embed AccessClaims.
+type PrincipalClaims interface {
+	jwt.Claims
+	Principal() *Principal
+}
+
+func (p *Principal) UserId() int64 {
+	if p == nil || p.User == nil {
+		return 0
+	}
+	return p.User.ID
+}
+
+func (p *Principal) HasRole(title string) bool {
+	if p == nil {
+		return false
+	}
+	for _, role := range p.Roles {
+		if role.Title == title {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	if p == nil {
+		return false
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (c AccessClaims) Principal() *Principal {
+	return &Principal{
+		User:    c.User,
+		Roles:   c.Roles,
+		TokenId: c.ID,
+		Scopes:  strings.Fields(c.Scope),
+	}
+}
+
+type principalContextKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p, UserMiddleware puts it into the request context.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// PrincipalFromContext returns the principal of the request ctx belongs to. *gin.Context is accepted as well.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	if c, ok := ctx.(*gin.Context); ok {
+		if c.Request == nil {
+			return nil, false
+		}
+		ctx = c.Request.Context()
+	}
+
+	p, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// UserFromContext returns the user of the request ctx belongs to.
+func UserFromContext(ctx context.Context) (models.User, bool) {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok || p.User == nil {
+		return models.User{}, false
+	}
+	return *p.User, true
+}
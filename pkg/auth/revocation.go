@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/iteais/sdk/pkg/utils"
+	"github.com/redis/go-redis/v9"
+	"github.com/uptrace/bun"
+)
+
+// RevocationList holds ids (jti) of access tokens revoked before they expire.
+type RevocationList interface {
+	Revoke(ctx context.Context, tokenId string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, tokenId string) (bool, error)
+}
+
+// ExpiringRevocationList deletes revoked tokens which already expired, see Issuer.Cleanup.
+type ExpiringRevocationList interface {
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+// DefaultRevocationPrefix is shared by all services: a token revoked by the issuer must be
+// rejected by every verifier, so the prefix must not depend on the application name.
+const DefaultRevocationPrefix = "sdk:revoked:"
+
+// RedisRevocationList keeps a key per revoked token until the token expires.
+type RedisRevocationList struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisRevocationList stores keys as prefix + jti, an empty prefix means DefaultRevocationPrefix.
+func NewRedisRevocationList(client *redis.Client, prefix string) *RedisRevocationList {
+	if prefix == "" {
+		prefix = DefaultRevocationPrefix
+	}
+	return &RedisRevocationList{client: client, prefix: prefix}
+}
+
+func (r *RedisRevocationList) Revoke(ctx context.Context, tokenId string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return r.client.Set(ctx, r.prefix+tokenId, 1, ttl).Err()
+}
+
+func (r *RedisRevocationList) IsRevoked(ctx context.Context, tokenId string) (bool, error) {
+	n, err := r.client.Exists(ctx, r.prefix+tokenId).Result()
+	return n > 0, err
+}
+
+type revokedToken struct {
+	bun.BaseModel `bun:"table:sdk_revoked_tokens"`
+
+	TokenId   string    `bun:",pk"`
+	ExpiresAt time.Time `bun:",notnull"`
+}
+
+// PgRevocationList keeps revoked tokens in the sdk_revoked_tokens table, created on first use.
+// The table lives in the database of one service, so revocations are not seen by other services:
+// use RedisRevocationList when tokens are verified by more than one service. Put CachedRevocationList
+// in front of it to avoid a query on every verified token.
+type PgRevocationList struct {
+	db     *bun.DB
+	initMu sync.Mutex
+	inited bool
+}
+
+func NewPgRevocationList(db *bun.DB) *PgRevocationList {
+	return &PgRevocationList{db: db}
+}
+
+// init creates the table, a failed attempt is retried on the next call.
+func (p *PgRevocationList) init(ctx context.Context) error {
+	p.initMu.Lock()
+	defer p.initMu.Unlock()
+	if p.inited {
+		return nil
+	}
+
+	// Отмена запроса, который первым создает таблицу, не должна прерывать DDL
+	ctx = context.WithoutCancel(ctx)
+	if _, err := p.db.NewCreateTable().Model((*revokedToken)(nil)).IfNotExists().Exec(ctx); err != nil {
+		return err
+	}
+	p.inited = true
+	return nil
+}
+
+func (p *PgRevocationList) Revoke(ctx context.Context, tokenId string, expiresAt time.Time) error {
+	if err := p.init(ctx); err != nil {
+		return err
+	}
+	_, err := p.db.NewInsert().Model(&revokedToken{TokenId: tokenId, ExpiresAt: expiresAt}).
+		On("CONFLICT (token_id) DO NOTHING").Exec(ctx)
+	return err
+}
+
+func (p *PgRevocationList) IsRevoked(ctx context.Context, tokenId string) (bool, error) {
+	if err := p.init(ctx); err != nil {
+		return false, err
+	}
+	return p.db.NewSelect().Model((*revokedToken)(nil)).
+		Where("token_id = ?", tokenId).
+		Where("expires_at > ?", time.Now()).
+		Exists(ctx)
+}
+
+// DeleteExpired removes tokens which already expired and can not be used anyway.
+func (p *PgRevocationList) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	if err := p.init(ctx); err != nil {
+		return 0, err
+	}
+	res, err := p.db.NewDelete().Model((*revokedToken)(nil)).Where("expires_at < ?", before).Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CachedRevocationList keeps answers of list in process memory for TTL, so a verifier does not
+// query list on every request. Tokens revoked through it are rejected at once, revocations made by
+// other processes are seen after TTL.
+type CachedRevocationList struct {
+	list  RevocationList
+	ttl   time.Duration
+	local *utils.LRU[string, bool]
+}
+
+// NewCachedRevocationList caches answers of list for ttl, default 30s.
+func NewCachedRevocationList(list RevocationList, ttl time.Duration) *CachedRevocationList {
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	return &CachedRevocationList{list: list, ttl: ttl, local: utils.NewLRU[string, bool](10000)}
+}
+
+func (r *CachedRevocationList) Revoke(ctx context.Context, tokenId string, expiresAt time.Time) error {
+	if err := r.list.Revoke(ctx, tokenId, expiresAt); err != nil {
+		return err
+	}
+	r.local.Set(tokenId, true, time.Until(expiresAt))
+	return nil
+}
+
+func (r *CachedRevocationList) IsRevoked(ctx context.Context, tokenId string) (bool, error) {
+	if revoked, ok := r.local.Get(tokenId); ok {
+		return revoked, nil
+	}
+
+	revoked, err := r.list.IsRevoked(ctx, tokenId)
+	if err != nil {
+		return false, err
+	}
+	r.local.Set(tokenId, revoked, r.ttl)
+	return revoked, nil
+}
+
+// DeleteExpired deletes expired tokens of list if it is an ExpiringRevocationList.
+func (r *CachedRevocationList) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	if list, ok := r.list.(ExpiringRevocationList); ok {
+		return list.DeleteExpired(ctx, before)
+	}
+	return 0, nil
+}
+
+// MemoryRevocationList keeps revoked tokens in process memory, for tests.
+type MemoryRevocationList struct {
+	mu     sync.Mutex
+	tokens map[string]time.Time
+}
+
+func NewMemoryRevocationList() *MemoryRevocationList {
+	return &MemoryRevocationList{tokens: make(map[string]time.Time)}
+}
+
+func (m *MemoryRevocationList) Revoke(_ context.Context, tokenId string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, expires := range m.tokens {
+		if expires.Before(now) {
+			delete(m.tokens, id)
+		}
+	}
+
+	m.tokens[tokenId] = expiresAt
+	return nil
+}
+
+func (m *MemoryRevocationList) IsRevoked(_ context.Context, tokenId string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expires, ok := m.tokens[tokenId]
+	return ok && time.Now().Before(expires), nil
+}
@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// RefreshToken is a stored refresh token. The token itself is never stored, only its sha256.
+type RefreshToken struct {
+	bun.BaseModel `bun:"table:sdk_refresh_tokens"`
+
+	Hash      string     `bun:",pk"`
+	FamilyId  string     `bun:",notnull"`
+	UserId    int64      `bun:",notnull"`
+	ExpiresAt time.Time  `bun:",notnull"`
+	UsedAt    *time.Time `bun:",nullzero"`
+	RevokedAt *time.Time `bun:",nullzero"`
+	CreatedAt time.Time  `bun:",notnull"`
+}
+
+type RefreshStore interface {
+	Create(ctx context.Context, token *RefreshToken) error
+	// Find returns ErrInvalidRefreshToken for unknown hashes.
+	Find(ctx context.Context, hash string) (*RefreshToken, error)
+	// Use marks the token as exchanged. It returns false if the token was already used or revoked.
+	Use(ctx context.Context, hash string, at time.Time) (bool, error)
+	RevokeFamily(ctx context.Context, familyId string, at time.Time) error
+	// DeleteExpired removes tokens which expired before the given time.
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+// PgRefreshStore keeps refresh tokens in the sdk_refresh_tokens table, created on first use.
+type PgRefreshStore struct {
+	db     *bun.DB
+	initMu sync.Mutex
+	inited bool
+}
+
+func NewPgRefreshStore(db *bun.DB) *PgRefreshStore {
+	return &PgRefreshStore{db: db}
+}
+
+// init creates the table and its index, a failed attempt is retried on the next call.
+func (s *PgRefreshStore) init(ctx context.Context) error {
+	s.initMu.Lock()
+	defer s.initMu.Unlock()
+	if s.inited {
+		return nil
+	}
+
+	// Отмена запроса, который первым создает таблицу, не должна прерывать DDL
+	ctx = context.WithoutCancel(ctx)
+	if _, err := s.db.NewCreateTable().Model((*RefreshToken)(nil)).IfNotExists().Exec(ctx); err != nil {
+		return err
+	}
+	_, err := s.db.NewCreateIndex().Model((*RefreshToken)(nil)).IfNotExists().
+		Index("sdk_refresh_tokens_family_id_idx").Column("family_id").Exec(ctx)
+	if err != nil {
+		return err
+	}
+	s.inited = true
+	return nil
+}
+
+func (s *PgRefreshStore) Create(ctx context.Context, token *RefreshToken) error {
+	if err := s.init(ctx); err != nil {
+		return err
+	}
+	_, err := s.db.NewInsert().Model(token).Exec(ctx)
+	return err
+}
+
+func (s *PgRefreshStore) Find(ctx context.Context, hash string) (*RefreshToken, error) {
+	if err := s.init(ctx); err != nil {
+		return nil, err
+	}
+
+	token := &RefreshToken{}
+	err := s.db.NewSelect().Model(token).Where("hash = ?", hash).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (s *PgRefreshStore) Use(ctx context.Context, hash string, at time.Time) (bool, error) {
+	if err := s.init(ctx); err != nil {
+		return false, err
+	}
+
+	res, err := s.db.NewUpdate().Model((*RefreshToken)(nil)).
+		Set("used_at = ?", at).
+		Where("hash = ?", hash).
+		Where("used_at IS NULL").
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	return affected == 1, err
+}
+
+func (s *PgRefreshStore) RevokeFamily(ctx context.Context, familyId string, at time.Time) error {
+	if err := s.init(ctx); err != nil {
+		return err
+	}
+
+	_, err := s.db.NewUpdate().Model((*RefreshToken)(nil)).
+		Set("revoked_at = ?", at).
+		Where("family_id = ?", familyId).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	return err
+}
+
+func (s *PgRefreshStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	if err := s.init(ctx); err != nil {
+		return 0, err
+	}
+
+	res, err := s.db.NewDelete().Model((*RefreshToken)(nil)).Where("expires_at < ?", before).Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// MemoryRefreshStore keeps refresh tokens in process memory, for tests.
+type MemoryRefreshStore struct {
+	mu     sync.Mutex
+	tokens map[string]RefreshToken
+}
+
+func NewMemoryRefreshStore() *MemoryRefreshStore {
+	return &MemoryRefreshStore{tokens: make(map[string]RefreshToken)}
+}
+
+func (s *MemoryRefreshStore) Create(_ context.Context, token *RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[token.Hash] = *token
+	return nil
+}
+
+func (s *MemoryRefreshStore) Find(_ context.Context, hash string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+	return &token, nil
+}
+
+func (s *MemoryRefreshStore) Use(_ context.Context, hash string, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok || token.UsedAt != nil || token.RevokedAt != nil {
+		return false, nil
+	}
+
+	token.UsedAt = &at
+	s.tokens[hash] = token
+	return true, nil
+}
+
+func (s *MemoryRefreshStore) RevokeFamily(_ context.Context, familyId string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, token := range s.tokens {
+		if token.FamilyId == familyId && token.RevokedAt == nil {
+			token.RevokedAt = &at
+			s.tokens[hash] = token
+		}
+	}
+	return nil
+}
+
+func (s *MemoryRefreshStore) DeleteExpired(_ context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for hash, token := range s.tokens {
+		if token.ExpiresAt.Before(before) {
+			delete(s.tokens, hash)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
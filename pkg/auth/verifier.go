@@ -0,0 +1,312 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// UserJwtHttpHeader is the header used by services to pass the user token.
+	UserJwtHttpHeader = "User-Jwt"
+)
+
+var (
+	ErrUnknownKey   = errors.New("auth: unknown key id")
+	ErrTokenRevoked = errors.New("auth: token revoked")
+)
+
+type VerifierConfig struct {
+	// Secret enables HMAC algorithms (HS256, HS384, HS512) with a shared secret.
+	Secret string
+	// JWKS is a key set location: an http(s) URL, a file:// URL or a file path.
+	JWKS string
+	// RefreshInterval of the key set. Default 10m.
+	RefreshInterval time.Duration
+	// Algorithms allowed in the token header. Default RS256, ES256, EdDSA for JWKS and HS256 for Secret.
+	Algorithms []string
+	// Issuer is checked against the iss claim when not empty.
+	Issuer string
+	// Audience is checked against the aud claim when not empty. One match is enough.
+	Audience []string
+	// Leeway for exp, nbf and iat checks.
+	Leeway time.Duration
+	// AcceptBearer reads the token from "Authorization: Bearer" when User-Jwt is empty.
+	AcceptBearer bool
+	// Revocations rejects tokens whose jti was revoked, e.g. on logout.
+	Revocations RevocationList
+}
+
+// VerifierConfigFromEnv reads JWT_SECRET, JWKS_URL, JWT_ALGORITHMS, JWT_ISSUER, JWT_AUDIENCE,
+// JWT_LEEWAY and JWT_ACCEPT_BEARER.
+func VerifierConfigFromEnv() VerifierConfig {
+	config := VerifierConfig{
+		Secret:       os.Getenv("JWT_SECRET"),
+		JWKS:         os.Getenv("JWKS_URL"),
+		Issuer:       os.Getenv("JWT_ISSUER"),
+		AcceptBearer: os.Getenv("JWT_ACCEPT_BEARER") == "true",
+	}
+	if algorithms := os.Getenv("JWT_ALGORITHMS"); algorithms != "" {
+		config.Algorithms = strings.Split(algorithms, ",")
+	}
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		config.Audience = strings.Split(audience, ",")
+	}
+	config.Leeway, _ = time.ParseDuration(os.Getenv("JWT_LEEWAY"))
+
+	return config
+}
+
+// Verifier validates user tokens signed with a shared secret or with keys of a JWKS.
+type Verifier struct {
+	config VerifierConfig
+	parser *jwt.Parser
+	client *http.Client
+
+	mu   sync.RWMutex
+	keys map[string]any
+
+	refreshLock sync.Mutex
+	// attemptedAt is the time of the last reload, successful or not. It is guarded by refreshLock.
+	attemptedAt time.Time
+}
+
+func NewVerifier(config VerifierConfig) *Verifier {
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = 10 * time.Minute
+	}
+	if len(config.Algorithms) == 0 {
+		if config.JWKS != "" {
+			config.Algorithms = append(config.Algorithms, "RS256", "ES256", "EdDSA")
+		}
+		if config.Secret != "" {
+			config.Algorithms = append(config.Algorithms, "HS256")
+		}
+	}
+
+	options := []jwt.ParserOption{jwt.WithValidMethods(config.Algorithms), jwt.WithLeeway(config.Leeway)}
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+	if len(config.Audience) > 0 {
+		options = append(options, jwt.WithAudience(config.Audience...))
+	}
+
+	return &Verifier{
+		config: config,
+		parser: jwt.NewParser(options...),
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]any),
+	}
+}
+
+// Refresh reloads the key set. It is a no-op without JWKS.
+func (v *Verifier) Refresh(ctx context.Context) error {
+	if v.config.JWKS == "" {
+		return nil
+	}
+
+	v.refreshLock.Lock()
+	defer v.refreshLock.Unlock()
+
+	return v.refresh(ctx)
+}
+
+// refresh must be called with refreshLock held.
+func (v *Verifier) refresh(ctx context.Context) error {
+	v.attemptedAt = time.Now()
+
+	data, err := v.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+
+	return nil
+}
+
+// Start refreshes the key set every RefreshInterval until ctx is done.
+func (v *Verifier) Start(ctx context.Context) {
+	if v.config.JWKS == "" {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(v.config.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := v.Refresh(ctx); err != nil {
+					logrus.WithError(err).Warn("auth: jwks refresh failed")
+				}
+			}
+		}
+	}()
+}
+
+// Verify parses and validates the token into MapClaims.
+func (v *Verifier) Verify(ctx context.Context, tokenString string) (*jwt.Token, error) {
+	return v.VerifyWithClaims(ctx, tokenString, jwt.MapClaims{})
+}
+
+// VerifyWithClaims parses and validates the token into claims.
+func (v *Verifier) VerifyWithClaims(ctx context.Context, tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	token, err := v.parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
+		return v.keyFunc(ctx, token)
+	})
+	if err != nil || v.config.Revocations == nil {
+		return token, err
+	}
+
+	if id := tokenId(claims); id != "" {
+		revoked, err := v.config.Revocations.IsRevoked(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	return token, nil
+}
+
+// TokenFromRequest returns the User-Jwt header or, if enabled, the Authorization bearer token.
+func (v *Verifier) TokenFromRequest(r *http.Request) string {
+	return tokenFromRequest(r, v.config.AcceptBearer)
+}
+
+func tokenFromRequest(r *http.Request, acceptBearer bool) string {
+	if token := r.Header.Get(UserJwtHttpHeader); token != "" {
+		return token
+	}
+
+	if acceptBearer {
+		header := r.Header.Get("Authorization")
+		if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+			return header[7:]
+		}
+	}
+
+	return ""
+}
+
+func (v *Verifier) keyFunc(ctx context.Context, token *jwt.Token) (any, error) {
+	if strings.HasPrefix(token.Method.Alg(), "HS") {
+		if v.config.Secret == "" {
+			return nil, errors.New("auth: HMAC tokens are not accepted")
+		}
+		return []byte(v.config.Secret), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	if key, ok := v.key(kid); ok {
+		return key, nil
+	}
+
+	if err := v.refreshUnknown(ctx, kid); err != nil {
+		return nil, err
+	}
+	if key, ok := v.key(kid); ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+}
+
+// refreshUnknown reloads the set for a kid which may belong to rotated keys. Reloads, failed ones
+// included, happen at most once per 30 seconds, so tokens with random kids can not flood the issuer.
+func (v *Verifier) refreshUnknown(ctx context.Context, kid string) error {
+	if v.config.JWKS == "" {
+		return nil
+	}
+
+	v.refreshLock.Lock()
+	defer v.refreshLock.Unlock()
+
+	// Пока ждали блокировку, набор мог обновить другой запрос
+	if _, ok := v.key(kid); ok || time.Since(v.attemptedAt) < 30*time.Second {
+		return nil
+	}
+	return v.refresh(ctx)
+}
+
+func tokenId(claims jwt.Claims) string {
+	switch c := claims.(type) {
+	case jwt.MapClaims:
+		id, _ := c["jti"].(string)
+		return id
+	case *jwt.RegisteredClaims:
+		return c.ID
+	case interface{ TokenId() string }:
+		return c.TokenId()
+	}
+	return ""
+}
+
+func (v *Verifier) key(kid string) (any, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if key, ok := v.keys[kid]; ok {
+		return key, true
+	}
+
+	// Tokens without kid are accepted when the set has exactly one key.
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
+
+func (v *Verifier) load(ctx context.Context) ([]byte, error) {
+	location := v.config.JWKS
+
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return os.ReadFile(strings.TrimPrefix(location, "file://"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("auth: jwks %s returned %s", location, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
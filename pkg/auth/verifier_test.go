@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) JWK {
+	return JWK{Kid: kid, Kty: "RSA", Use: "sig", N: b64(key.N.Bytes()), E: b64(big.NewInt(int64(key.E)).Bytes())}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) JWK {
+	return JWK{Kid: kid, Kty: "EC", Crv: "P-256", X: b64(key.X.FillBytes(make([]byte, 32))), Y: b64(key.Y.FillBytes(make([]byte, 32)))}
+}
+
+func edJWK(kid string, key ed25519.PublicKey) JWK {
+	return JWK{Kid: kid, Kty: "OKP", Crv: "Ed25519", X: b64(key)}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func claims() jwt.MapClaims {
+	return jwt.MapClaims{"user": map[string]any{"id": 1}, "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+// jwksServer is a local stand-in for an identity provider.
+type jwksServer struct {
+	*httptest.Server
+	keys     atomic.Value
+	requests atomic.Int32
+}
+
+func newJwksServer(keys ...JWK) *jwksServer {
+	s := &jwksServer{}
+	s.keys.Store(keys)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		_ = json.NewEncoder(w).Encode(JWKS{Keys: s.keys.Load().([]JWK)})
+	}))
+	return s
+}
+
+func TestVerifier_Algorithms(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	server := newJwksServer(rsaJWK("rsa", &rsaKey.PublicKey), ecJWK("ec", &ecKey.PublicKey), edJWK("ed", edPub))
+	defer server.Close()
+
+	verifier := NewVerifier(VerifierConfig{JWKS: server.URL, Secret: "secret"})
+	require.NoError(t, verifier.Refresh(context.Background()))
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"RS256", sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims()), true},
+		{"ES256", sign(t, jwt.SigningMethodES256, "ec", ecKey, claims()), true},
+		{"EdDSA", sign(t, jwt.SigningMethodEdDSA, "ed", edKey, claims()), true},
+		{"HS256", sign(t, jwt.SigningMethodHS256, "", []byte("secret"), claims()), true},
+		{"HS256 wrong secret", sign(t, jwt.SigningMethodHS256, "", []byte("other"), claims()), false},
+		{"RS512 not allowed", sign(t, jwt.SigningMethodRS512, "rsa", rsaKey, claims()), false},
+		{"kid of another key", sign(t, jwt.SigningMethodRS256, "ec", rsaKey, claims()), false},
+		{"expired", sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(context.Background(), tt.token)
+			assert.Equal(t, tt.valid, err == nil, err)
+		})
+	}
+}
+
+func TestVerifier_HmacOnlyWithoutSecret(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := newJwksServer(rsaJWK("rsa", &rsaKey.PublicKey))
+	defer server.Close()
+
+	verifier := NewVerifier(VerifierConfig{JWKS: server.URL, Algorithms: []string{"RS256", "HS256"}})
+	require.NoError(t, verifier.Refresh(context.Background()))
+
+	_, err := verifier.Verify(context.Background(), sign(t, jwt.SigningMethodHS256, "", []byte(""), claims()))
+	assert.Error(t, err)
+}
+
+func TestVerifier_Rotation(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	server := newJwksServer(rsaJWK("old", &oldKey.PublicKey))
+	defer server.Close()
+
+	verifier := NewVerifier(VerifierConfig{JWKS: server.URL})
+	require.NoError(t, verifier.Refresh(context.Background()))
+
+	server.keys.Store([]JWK{rsaJWK("old", &oldKey.PublicKey), rsaJWK("new", &newKey.PublicKey)})
+
+	// Refreshed less than 30 seconds ago, the unknown kid does not hit the server
+	_, err := verifier.Verify(context.Background(), sign(t, jwt.SigningMethodRS256, "new", newKey, claims()))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	assert.EqualValues(t, 1, server.requests.Load())
+
+	verifier.attemptedAt = time.Now().Add(-time.Minute)
+
+	_, err = verifier.Verify(context.Background(), sign(t, jwt.SigningMethodRS256, "new", newKey, claims()))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, server.requests.Load())
+}
+
+func TestVerifier_FailedRefreshIsThrottled(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	verifier := NewVerifier(VerifierConfig{JWKS: server.URL})
+
+	_, err := verifier.Verify(context.Background(), sign(t, jwt.SigningMethodRS256, "a", key, claims()))
+	assert.Error(t, err)
+	_, err = verifier.Verify(context.Background(), sign(t, jwt.SigningMethodRS256, "b", key, claims()))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	assert.EqualValues(t, 1, requests.Load())
+}
+
+func TestVerifier_IssuerAudience(t *testing.T) {
+	verifier := NewVerifier(VerifierConfig{Secret: "secret", Issuer: "auth", Audience: []string{"events", "users"}})
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		valid  bool
+	}{
+		{"valid", jwt.MapClaims{"iss": "auth", "aud": "users"}, true},
+		{"audience list", jwt.MapClaims{"iss": "auth", "aud": []string{"billing", "events"}}, true},
+		{"wrong issuer", jwt.MapClaims{"iss": "other", "aud": "users"}, false},
+		{"wrong audience", jwt.MapClaims{"iss": "auth", "aud": "billing"}, false},
+		{"no audience", jwt.MapClaims{"iss": "auth"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(context.Background(), sign(t, jwt.SigningMethodHS256, "", []byte("secret"), tt.claims))
+			assert.Equal(t, tt.valid, err == nil, err)
+		})
+	}
+}
+
+func TestVerifier_Leeway(t *testing.T) {
+	token := sign(t, jwt.SigningMethodHS256, "", []byte("secret"), jwt.MapClaims{"exp": time.Now().Add(-10 * time.Second).Unix()})
+
+	_, err := NewVerifier(VerifierConfig{Secret: "secret"}).Verify(context.Background(), token)
+	assert.Error(t, err)
+
+	_, err = NewVerifier(VerifierConfig{Secret: "secret", Leeway: time.Minute}).Verify(context.Background(), token)
+	assert.NoError(t, err)
+}
+
+func TestVerifier_File(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	data, _ := json.Marshal(JWKS{Keys: []JWK{rsaJWK("file", &key.PublicKey)}})
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	for _, location := range []string{path, "file://" + path} {
+		verifier := NewVerifier(VerifierConfig{JWKS: location})
+		require.NoError(t, verifier.Refresh(context.Background()))
+
+		_, err := verifier.Verify(context.Background(), sign(t, jwt.SigningMethodRS256, "", key, claims()))
+		assert.NoError(t, err, location)
+	}
+}
+
+func TestVerifier_TokenFromRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer abc")
+
+	assert.Empty(t, NewVerifier(VerifierConfig{}).TokenFromRequest(req))
+	assert.Equal(t, "abc", NewVerifier(VerifierConfig{AcceptBearer: true}).TokenFromRequest(req))
+
+	req.Header.Set(UserJwtHttpHeader, "xyz")
+	assert.Equal(t, "xyz", NewVerifier(VerifierConfig{AcceptBearer: true}).TokenFromRequest(req))
+}
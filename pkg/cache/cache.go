@@ -2,41 +2,57 @@ package cache
 
 import (
 	"context"
-	"os"
-	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-redis/cache/v9"
 	"github.com/iteais/sdk/pkg"
-	"github.com/redis/go-redis/v9"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+var cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "cache_requests_total",
+	Help: "GetOrSet calls by result (hit, miss, disabled).",
+}, []string{"result"})
+
+var (
+	appCache     *cache.Cache
+	appCacheOnce sync.Once
+)
+
+func getCache() *cache.Cache {
+	appCacheOnce.Do(func() {
+		if pkg.App == nil || pkg.App.Redis == nil {
+			return
+		}
+
+		appCache = cache.New(&cache.Options{
+			Redis:      pkg.App.Redis,
+			LocalCache: cache.NewTinyLFU(1000, time.Minute),
+		})
+	})
+
+	return appCache
+}
+
 func GetOrSet[T any](key string, f func() T, duration time.Duration) *T {
 	val := *new(T)
 
-	port, err := strconv.Atoi(os.Getenv("REDIS_DB"))
+	appCache := getCache()
 
-	if err != nil {
-		pkg.App.Log.Warn("error parsing redis db", err)
+	if appCache == nil {
+		pkg.App.Log.Warn("redis is not configured, cache is disabled")
+		cacheRequests.WithLabelValues("disabled").Inc()
 		val = f()
 		return &val
 	}
 
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     os.Getenv("REDIS_HOST") + ":" + os.Getenv("REDIS_PORT"),
-		Password: "", // no password set
-		DB:       port,
-	})
-
-	appCache := cache.New(&cache.Options{
-		Redis:      rdb,
-		LocalCache: cache.NewTinyLFU(1000, time.Minute),
-	})
-
 	ctx := context.TODO()
-	err = appCache.Get(ctx, key, &val)
+	err := appCache.Get(ctx, key, &val)
 
 	if err != nil {
+		cacheRequests.WithLabelValues("miss").Inc()
 		val = f()
 		_ = appCache.Set(&cache.Item{
 			Ctx:   ctx,
@@ -44,6 +60,8 @@ func GetOrSet[T any](key string, f func() T, duration time.Duration) *T {
 			Value: val,
 			TTL:   duration,
 		})
+	} else {
+		cacheRequests.WithLabelValues("hit").Inc()
 	}
 	return &val
 }
@@ -1,24 +1,31 @@
 package pkg
 
 import (
-	"github.com/gin-gonic/gin"
-	"github.com/uptrace/bun"
 	"net/http"
 	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/health"
+	"github.com/uptrace/bun"
 )
 
+// HealthProbe checks only the database.
+//
+// Deprecated: use HealthReport with Application.Health.
 func HealthProbe(db *bun.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		_, err := db.Exec("SELECT 1 = 1")
-
-		if err != nil {
+		if err := db.PingContext(c); err != nil {
 			c.AbortWithStatus(http.StatusServiceUnavailable)
+			return
 		}
 
-		c.Writer.WriteHeader(http.StatusOK)
+		c.Status(http.StatusOK)
 	}
 }
 
+// ReadyProbe reports the flag only.
+//
+// Deprecated: use ReadinessProbe with Application.Health.
 func ReadyProbe(isReady *atomic.Value) http.HandlerFunc {
 	return func(w http.ResponseWriter, _ *http.Request) {
 		if isReady == nil || !isReady.Load().(bool) {
@@ -28,3 +35,35 @@ func ReadyProbe(isReady *atomic.Value) http.HandlerFunc {
 		w.WriteHeader(http.StatusOK)
 	}
 }
+
+// LiveProbe answers while the process can serve requests, dependencies are not checked:
+// a restart does not help when the database is down.
+func LiveProbe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": health.StatusUp})
+	}
+}
+
+// ReadinessProbe responds 503 while the server is not serving or a critical check fails.
+func ReadinessProbe(registry *health.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := registry.Run(c)
+		c.JSON(reportStatusCode(report), gin.H{"status": report.Status})
+	}
+}
+
+// HealthReport responds with results of all checks, the status code is the one of ReadinessProbe.
+// Errors of checks are not redacted, serve it only on protected routes like HealthReportEndpoint.
+func HealthReport(registry *health.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := registry.Run(c)
+		c.JSON(reportStatusCode(report), report)
+	}
+}
+
+func reportStatusCode(report health.Report) int {
+	if report.Status == health.StatusDown {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
@@ -0,0 +1,52 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/health"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthProbes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	a := &Application{Router: gin.New(), Health: health.NewRegistry()}
+	a.Health.Register(health.Check{Name: "db", Critical: true, CacheTtl: -1, Check: func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}})
+	a.AppendHealthProbe().AppendReadyProbe()
+
+	call := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		a.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, call(LiveEndpoint).Code)
+
+	w := call(HealthReadyEndpoint)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"status":"down"}`, w.Body.String())
+	assert.Equal(t, http.StatusServiceUnavailable, call(ReadyEndpoint).Code)
+
+	w = call(HealthEndpoint)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"status":"down"}`, w.Body.String())
+
+	w = call(HealthReportEndpoint)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"error":"connection refused"`)
+
+	a.Health.Register(health.Check{Name: "db", Critical: true, Check: func(ctx context.Context) error {
+		return nil
+	}})
+	assert.Equal(t, http.StatusServiceUnavailable, call(HealthReadyEndpoint).Code, "not serving yet")
+
+	a.Health.SetServing(true)
+	assert.Equal(t, http.StatusOK, call(HealthReadyEndpoint).Code)
+}
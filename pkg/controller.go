@@ -13,6 +13,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/iteais/sdk/pkg/models"
+	"github.com/iteais/sdk/pkg/stream"
 	"github.com/iteais/sdk/pkg/utils"
 	"github.com/uptrace/bun"
 )
@@ -75,6 +76,11 @@ func ListAction[T interface{}](postFindFuncs ...func(*gin.Context, *[]T)) func(c
 
 		ApplyFilter[T](c, query)
 
+		// Условные права ("event.read:own") сужают запрос, чтобы страницы и X-Total-Count считались по своим моделям
+		if !AuthorizeQuery(c, query, new(T)) {
+			return
+		}
+
 		var wg sync.WaitGroup
 		wg.Add(1)
 		go func() {
@@ -82,9 +88,7 @@ func ListAction[T interface{}](postFindFuncs ...func(*gin.Context, *[]T)) func(c
 			appendLastModifiedHeader[T](c)
 		}()
 
-		fmt.Println(query.String())
-
-		count, err := query.ScanAndCount(context.Background())
+		count, err := query.ScanAndCount(c)
 
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -110,6 +114,7 @@ func ListAction[T interface{}](postFindFuncs ...func(*gin.Context, *[]T)) func(c
 		}
 
 		wg.Wait()
+
 		c.JSON(200, gin.H{"data": modelsArray})
 	}
 }
@@ -192,6 +197,10 @@ func UpdateAction[T interface{}](pk string) func(*gin.Context) {
 			return
 		}
 
+		if !AuthorizeModel(c, existModel) {
+			return
+		}
+
 		newModel, loadErrors := models.LoadModel(c, existModel, make(map[string]string))
 
 		if len(loadErrors) > 0 {
@@ -199,6 +208,11 @@ func UpdateAction[T interface{}](pk string) func(*gin.Context) {
 			return
 		}
 
+		// Владелец мог быть изменен телом запроса
+		if !AuthorizeModel(c, newModel) {
+			return
+		}
+
 		q := App.Db.NewUpdate().
 			Model(newModel).
 			Where("? = ?", bun.Ident(pk), id)
@@ -206,11 +220,12 @@ func UpdateAction[T interface{}](pk string) func(*gin.Context) {
 		_, err = q.Exec(c)
 
 		if err != nil {
-			fmt.Println(q.String())
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err, "sql": q})
 			return
 		}
 
+		publishModelEvent(c, newModel, "updated")
+
 		c.JSON(http.StatusOK, newModel)
 		return
 	}
@@ -228,16 +243,20 @@ func CreateAction[T interface{}]() func(*gin.Context) {
 			return
 		}
 
-		query := App.Db.NewInsert().Model(&model)
+		if !AuthorizeModel(c, &model) {
+			return
+		}
 
-		App.Log.Info(query.String())
+		query := App.Db.NewInsert().Model(&model)
 
-		_, err := query.Exec(context.Background())
+		_, err := query.Exec(c)
 
 		errMsg := ""
 
 		if err != nil {
 			errMsg = err.Error()
+		} else {
+			publishModelEvent(c, &model, "created")
 		}
 
 		c.JSON(http.StatusCreated, gin.H{"data": model, "error": errMsg})
@@ -245,6 +264,23 @@ func CreateAction[T interface{}]() func(*gin.Context) {
 	}
 }
 
+func publishModelEvent(c *gin.Context, model interface{}, eventType string) {
+	streamed, ok := model.(models.ModelStreamed)
+	if !ok || App.Stream == nil {
+		return
+	}
+
+	// Событие получат только подписчики с правом чтения модели, см. AppendStream
+	restriction := stream.Restriction{Permission: streamed.StreamTopic() + ".read"}
+	if owned, ok := model.(models.ModelOwned); ok {
+		restriction.OwnerId = owned.OwnerId()
+	}
+
+	if err := App.Stream.PublishRestricted(c, streamed.StreamTopic(), eventType, model, restriction); err != nil {
+		App.GetRequestLogger(c).Warn("stream publish error: ", err)
+	}
+}
+
 func GetByField[T interface{}](filterFiled string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
@@ -276,8 +312,6 @@ func GetByField[T interface{}](filterFiled string) gin.HandlerFunc {
 			}
 		}
 
-		App.GetRequestLogger(c).Info(query.String())
-
 		count, err := query.ScanAndCount(c)
 
 		if count < 1 {
@@ -285,6 +319,10 @@ func GetByField[T interface{}](filterFiled string) gin.HandlerFunc {
 			return
 		}
 
+		if !AuthorizeModel(c, api) {
+			return
+		}
+
 		c.JSON(200, gin.H{"data": api, "error": err, "cnt": count})
 	}
 }
@@ -0,0 +1,211 @@
+package pkg
+
+import (
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CorsConfig struct {
+	// AllowOrigins are exact origins like "https://app.example.com". "*" allows any origin.
+	// Default CORS_ALLOW_ORIGINS (comma separated) or "*".
+	AllowOrigins []string
+	// AllowOriginPatterns are regexps of origins, e.g. `^https://[a-z0-9-]+\.example\.com$`.
+	AllowOriginPatterns []string
+	// AllowMethods default GET, POST, PUT, PATCH, DELETE, HEAD.
+	AllowMethods []string
+	// AllowHeaders of requests. Default the headers asked by the preflight request.
+	AllowHeaders []string
+	// ExposeHeaders readable by clients. Default pagination, Last-Modified, X-Trace-Id, Idempotent-Replayed and rate limit headers.
+	ExposeHeaders []string
+	// AllowCredentials allows cookies and HTTP auth for AllowOrigins and AllowOriginPatterns,
+	// it can not be combined with "*": any site could make authenticated requests.
+	AllowCredentials bool
+	// MaxAge of preflight responses in browser cache. Default 10m.
+	MaxAge time.Duration
+	// Groups override the policy for route groups by path prefix, the longest prefix wins.
+	// Empty fields of a group are taken from the main config, AllowCredentials only together with the origins.
+	//
+	//	Groups: map[string]CorsConfig{"/public": {AllowOrigins: []string{"*"}}}
+	Groups map[string]CorsConfig
+}
+
+type corsPolicy struct {
+	anyOrigin   bool
+	origins     []string
+	patterns    []*regexp.Regexp
+	methods     string
+	headers     string
+	expose      string
+	credentials bool
+	maxAge      string
+}
+
+type corsGroup struct {
+	prefix string
+	policy *corsPolicy
+}
+
+// CorsMiddleware Разрешает CORS запросы с любых origin
+func CorsMiddleware() gin.HandlerFunc {
+	return CorsMiddlewareWithConfig(CorsConfig{})
+}
+
+// CorsMiddlewareWithConfig Отвечает на CORS preflight и добавляет заголовки CORS для разрешенных origin.
+// Запросы без Origin проходят без изменений.
+func CorsMiddlewareWithConfig(config CorsConfig) gin.HandlerFunc {
+	if len(config.AllowOrigins) == 0 && len(config.AllowOriginPatterns) == 0 {
+		if origins := os.Getenv("CORS_ALLOW_ORIGINS"); origins != "" {
+			config.AllowOrigins = strings.Split(origins, ",")
+		} else {
+			config.AllowOrigins = []string{"*"}
+		}
+	}
+
+	policy := newCorsPolicy(config)
+
+	groups := make([]corsGroup, 0, len(config.Groups))
+	for prefix, groupConfig := range config.Groups {
+		groups = append(groups, corsGroup{prefix: prefix, policy: newCorsPolicy(groupConfig.inherit(config))})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return len(groups[i].prefix) > len(groups[j].prefix)
+	})
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		current := policy
+		for _, group := range groups {
+			if strings.HasPrefix(c.Request.URL.Path, group.prefix) {
+				current = group.policy
+				break
+			}
+		}
+
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if !current.allowed(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if current.anyOrigin {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if current.credentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if current.expose != "" {
+				header.Set("Access-Control-Expose-Headers", current.expose)
+			}
+			c.Next()
+			return
+		}
+
+		header.Set("Access-Control-Allow-Methods", current.methods)
+		if current.headers != "" {
+			header.Set("Access-Control-Allow-Headers", current.headers)
+		} else if requested := c.GetHeader("Access-Control-Request-Headers"); requested != "" {
+			header.Set("Access-Control-Allow-Headers", requested)
+		}
+		header.Set("Access-Control-Max-Age", current.maxAge)
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+func newCorsPolicy(config CorsConfig) *corsPolicy {
+	if config.AllowCredentials && slices.Contains(config.AllowOrigins, "*") {
+		panic(`cors: AllowCredentials can not be used with AllowOrigins "*", list the origins or AllowOriginPatterns`)
+	}
+	if len(config.AllowMethods) == 0 {
+		config.AllowMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead}
+	}
+	if config.ExposeHeaders == nil {
+		config.ExposeHeaders = []string{
+			"X-Total-Count", "X-Pagination-Per-Page", "X-Pagination-Page-Count", "X-Pagination-Current-Page",
+			"Last-Modified", TraceIdHttpHeader, IdempotencyReplayedHttpHeader,
+			RateLimitLimitHttpHeader, RateLimitRemainingHttpHeader, RateLimitResetHttpHeader, "Retry-After",
+		}
+	}
+	if config.MaxAge <= 0 {
+		config.MaxAge = 10 * time.Minute
+	}
+
+	policy := &corsPolicy{
+		anyOrigin:   slices.Contains(config.AllowOrigins, "*"),
+		origins:     config.AllowOrigins,
+		methods:     strings.Join(config.AllowMethods, ", "),
+		headers:     strings.Join(config.AllowHeaders, ", "),
+		expose:      strings.Join(config.ExposeHeaders, ", "),
+		credentials: config.AllowCredentials,
+		maxAge:      strconv.Itoa(int(config.MaxAge.Seconds())),
+	}
+
+	for _, pattern := range config.AllowOriginPatterns {
+		policy.patterns = append(policy.patterns, regexp.MustCompile(pattern))
+	}
+
+	return policy
+}
+
+// inherit fills empty fields of a group config from the main config.
+func (config CorsConfig) inherit(parent CorsConfig) CorsConfig {
+	if len(config.AllowOrigins) == 0 && len(config.AllowOriginPatterns) == 0 {
+		config.AllowOrigins = parent.AllowOrigins
+		config.AllowOriginPatterns = parent.AllowOriginPatterns
+		config.AllowCredentials = parent.AllowCredentials
+	}
+	if len(config.AllowMethods) == 0 {
+		config.AllowMethods = parent.AllowMethods
+	}
+	if config.AllowHeaders == nil {
+		config.AllowHeaders = parent.AllowHeaders
+	}
+	if config.ExposeHeaders == nil {
+		config.ExposeHeaders = parent.ExposeHeaders
+	}
+	if config.MaxAge <= 0 {
+		config.MaxAge = parent.MaxAge
+	}
+	return config
+}
+
+func (p *corsPolicy) allowed(origin string) bool {
+	if p.anyOrigin || slices.Contains(p.origins, origin) {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCorsTestRouter(config CorsConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(CorsMiddlewareWithConfig(config))
+	router.GET("/events", func(c *gin.Context) {
+		c.Header("X-Total-Count", "1")
+		c.Status(http.StatusOK)
+	})
+	router.OPTIONS("/events", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET("/public/events", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func corsRequest(router *gin.Engine, method string, path string, origin string, preflightMethod string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if preflightMethod != "" {
+		req.Header.Set("Access-Control-Request-Method", preflightMethod)
+		req.Header.Set("Access-Control-Request-Headers", "User-Jwt, Content-Type")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCorsMiddleware_Allowlist(t *testing.T) {
+	router := newCorsTestRouter(CorsConfig{
+		AllowOrigins:        []string{"https://app.example.com"},
+		AllowOriginPatterns: []string{`^https://[a-z0-9-]+\.preview\.example\.com$`},
+		AllowCredentials:    true,
+	})
+
+	w := corsRequest(router, http.MethodGet, "/events", "https://app.example.com", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), "X-Total-Count")
+	assert.Contains(t, w.Header().Values("Vary"), "Origin")
+
+	w = corsRequest(router, http.MethodGet, "/events", "https://pr-12.preview.example.com", "")
+	assert.Equal(t, "https://pr-12.preview.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = corsRequest(router, http.MethodGet, "/events", "https://evil.com", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = corsRequest(router, http.MethodOptions, "/events", "https://evil.com", http.MethodPatch)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestCorsMiddleware_Preflight(t *testing.T) {
+	router := newCorsTestRouter(CorsConfig{AllowOrigins: []string{"https://app.example.com"}})
+
+	w := corsRequest(router, http.MethodOptions, "/events", "https://app.example.com", http.MethodPatch)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "PATCH")
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "HEAD")
+	assert.Equal(t, "User-Jwt, Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	// Preflight for a route without OPTIONS handler
+	w = corsRequest(router, http.MethodOptions, "/public/events", "https://app.example.com", http.MethodGet)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// OPTIONS without CORS reaches the handler
+	w = corsRequest(router, http.MethodOptions, "/events", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestCorsMiddleware_Default(t *testing.T) {
+	t.Setenv("CORS_ALLOW_ORIGINS", "")
+	router := newCorsTestRouter(CorsConfig{})
+
+	w := corsRequest(router, http.MethodGet, "/events", "https://any.com", "")
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestCorsMiddleware_CredentialsWithAnyOrigin(t *testing.T) {
+	assert.Panics(t, func() {
+		CorsMiddlewareWithConfig(CorsConfig{AllowOrigins: []string{"*"}, AllowCredentials: true})
+	})
+	t.Setenv("CORS_ALLOW_ORIGINS", "")
+	assert.Panics(t, func() {
+		CorsMiddlewareWithConfig(CorsConfig{AllowCredentials: true})
+	})
+	assert.Panics(t, func() {
+		CorsMiddlewareWithConfig(CorsConfig{
+			AllowOrigins: []string{"https://app.example.com"},
+			Groups:       map[string]CorsConfig{"/public": {AllowOrigins: []string{"*"}, AllowCredentials: true}},
+		})
+	})
+}
+
+func TestCorsMiddleware_Groups(t *testing.T) {
+	router := newCorsTestRouter(CorsConfig{
+		AllowOrigins:     []string{"https://app.example.com"},
+		AllowCredentials: true,
+		AllowMethods:     []string{http.MethodGet},
+		Groups: map[string]CorsConfig{
+			"/public": {AllowOrigins: []string{"*"}, MaxAge: time.Hour},
+			"/events": {MaxAge: time.Hour},
+		},
+	})
+
+	// Группа без origins наследует их вместе с credentials и методами
+	w := corsRequest(router, http.MethodOptions, "/events", "https://app.example.com", http.MethodGet)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET", w.Header().Get("Access-Control-Allow-Methods"))
+
+	w = corsRequest(router, http.MethodGet, "/public/events", "https://other.com", "")
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	w = corsRequest(router, http.MethodGet, "/events", "https://other.com", "")
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = corsRequest(router, http.MethodGet, "/public/events", "https://other.com", "")
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = corsRequest(router, http.MethodOptions, "/public/events", "https://other.com", http.MethodGet)
+	assert.Equal(t, "3600", w.Header().Get("Access-Control-Max-Age"))
+}
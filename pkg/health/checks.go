@@ -0,0 +1,56 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/redis/go-redis/v9"
+	"github.com/uptrace/bun"
+)
+
+func Db(db *bun.DB) CheckFunc {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+func Redis(client *redis.Client) CheckFunc {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}
+}
+
+// Storage checks that S3 is reachable and accepts the credentials, the bucket may not exist.
+func Storage(client *minio.Client, bucket string) CheckFunc {
+	return func(ctx context.Context) error {
+		_, err := client.BucketExists(ctx, bucket)
+		return err
+	}
+}
+
+// Http expects a response below 500 from GET url, e.g. the ready probe of another service.
+func Http(client *http.Client, url string) CheckFunc {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("%s responded %d", strings.SplitN(url, "?", 2)[0], resp.StatusCode)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,191 @@
+// Package health runs dependency checks for liveness and readiness probes.
+//
+//	registry.Register(health.Check{Name: "db", Check: health.Db(db), Critical: true})
+//	report := registry.Run(ctx)
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDegraded = "degraded"
+
+	defaultTimeout  = 2 * time.Second
+	defaultCacheTtl = 2 * time.Second
+)
+
+// ErrNotReady is reported while the application is starting or stopping.
+var ErrNotReady = errors.New("application is not serving")
+
+type CheckFunc func(ctx context.Context) error
+
+type Check struct {
+	Name  string
+	Check CheckFunc
+	// Timeout defaults to 2s.
+	Timeout time.Duration
+	// Critical checks fail readiness, others only degrade the report.
+	Critical bool
+	// CacheTtl is how long a result is reused, 2s by default. Negative disables caching.
+	CacheTtl time.Duration
+}
+
+type CheckResult struct {
+	Status    string    `json:"status" example:"up"`
+	Critical  bool      `json:"critical"`
+	Error     string    `json:"error,omitempty"`
+	Duration  int64     `json:"duration_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type Report struct {
+	// Status is down if a critical check failed or the application is not serving,
+	// degraded if a non-critical check failed.
+	Status string                 `json:"status" example:"up"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+type entry struct {
+	check Check
+
+	mu     sync.Mutex
+	result CheckResult
+}
+
+type Registry struct {
+	mu      sync.RWMutex
+	entries []*entry
+	serving atomic.Bool
+	now     func() time.Time
+}
+
+func NewRegistry() *Registry {
+	return &Registry{now: time.Now}
+}
+
+// Register adds a check, a check with the same name is replaced.
+func (r *Registry) Register(check Check) {
+	if check.Name == "" || check.Check == nil {
+		panic("health: check must have Name and Check")
+	}
+	if check.Timeout == 0 {
+		check.Timeout = defaultTimeout
+	}
+	if check.CacheTtl == 0 {
+		check.CacheTtl = defaultCacheTtl
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, e := range r.entries {
+		if e.check.Name == check.Name {
+			r.entries[i] = &entry{check: check}
+			return
+		}
+	}
+	r.entries = append(r.entries, &entry{check: check})
+}
+
+// SetServing marks that the server accepts requests. Readiness fails until it is set and after it is unset on shutdown.
+func (r *Registry) SetServing(serving bool) {
+	r.serving.Store(serving)
+}
+
+func (r *Registry) Serving() bool {
+	return r.serving.Load()
+}
+
+// Run executes checks in parallel, results younger than CacheTtl are reused.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	entries := append([]*entry(nil), r.entries...)
+	r.mu.RUnlock()
+
+	results := make([]CheckResult, len(entries))
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = r.run(ctx, e)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]CheckResult, len(entries))}
+	for i, e := range entries {
+		result := results[i]
+		report.Checks[e.check.Name] = result
+
+		if result.Status == StatusUp {
+			continue
+		}
+		if result.Critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+
+	if !r.Serving() {
+		report.Status = StatusDown
+	}
+
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, e *entry) CheckResult {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := r.now()
+	if !e.result.CheckedAt.IsZero() && now.Sub(e.result.CheckedAt) < e.check.CacheTtl {
+		return e.result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.check.Timeout)
+	defer cancel()
+
+	err := runCheck(ctx, e.check.Check)
+
+	e.result = CheckResult{
+		Status:    StatusUp,
+		Critical:  e.check.Critical,
+		Duration:  r.now().Sub(now).Milliseconds(),
+		CheckedAt: now,
+	}
+	if err != nil {
+		e.result.Status = StatusDown
+		e.result.Error = err.Error()
+	}
+	return e.result
+}
+
+// runCheck stops waiting for a check which ignores ctx after the timeout.
+func runCheck(ctx context.Context, check CheckFunc) error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("panic: %v", p)
+			}
+		}()
+		done <- check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
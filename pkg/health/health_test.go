@@ -0,0 +1,101 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_Run(t *testing.T) {
+	registry := NewRegistry()
+	registry.SetServing(true)
+
+	var dbErr error
+	registry.Register(Check{Name: "db", Critical: true, CacheTtl: -1, Check: func(ctx context.Context) error {
+		return dbErr
+	}})
+	registry.Register(Check{Name: "storage", CacheTtl: -1, Check: func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}})
+
+	report := registry.Run(context.Background())
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.Equal(t, StatusUp, report.Checks["db"].Status)
+	assert.True(t, report.Checks["db"].Critical)
+	assert.Equal(t, "connection refused", report.Checks["storage"].Error)
+
+	dbErr = errors.New("too many connections")
+	report = registry.Run(context.Background())
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, "too many connections", report.Checks["db"].Error)
+
+	dbErr = nil
+	registry.SetServing(false)
+	assert.Equal(t, StatusDown, registry.Run(context.Background()).Status)
+}
+
+func TestRegistry_Cache(t *testing.T) {
+	registry := NewRegistry()
+	registry.SetServing(true)
+
+	now := time.Unix(1_700_000_000, 0)
+	registry.now = func() time.Time {
+		return now
+	}
+
+	var calls atomic.Int32
+	registry.Register(Check{Name: "db", CacheTtl: 5 * time.Second, Check: func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	}})
+
+	registry.Run(context.Background())
+	registry.Run(context.Background())
+	assert.Equal(t, int32(1), calls.Load())
+
+	now = now.Add(5 * time.Second)
+	registry.Run(context.Background())
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestRegistry_Timeout(t *testing.T) {
+	registry := NewRegistry()
+	registry.SetServing(true)
+
+	block := make(chan struct{})
+	defer close(block)
+
+	// Проверка, которая игнорирует ctx, не задерживает ответ
+	registry.Register(Check{Name: "slow", Critical: true, Timeout: 20 * time.Millisecond, Check: func(ctx context.Context) error {
+		<-block
+		return nil
+	}})
+	registry.Register(Check{Name: "panic", Check: func(ctx context.Context) error {
+		panic("boom")
+	}})
+
+	report := registry.Run(context.Background())
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["slow"].Error)
+	assert.Equal(t, "panic: boom", report.Checks["panic"].Error)
+}
+
+func TestHttp(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	check := Http(nil, server.URL+"/ready")
+	assert.NoError(t, check(context.Background()))
+
+	status = http.StatusServiceUnavailable
+	assert.EqualError(t, check(context.Background()), server.URL+"/ready responded 503")
+}
@@ -0,0 +1,64 @@
+package pkg
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// NonceStore remembers Api-Nonce values of signed requests for the acceptance window.
+type NonceStore interface {
+	// Use records the nonce for ttl and returns false if it was already recorded.
+	Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// RedisNonceStore keeps nonces in Redis under <prefix>:nonce:<nonce>.
+type RedisNonceStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisNonceStore(client *redis.Client, prefix string) *RedisNonceStore {
+	return &RedisNonceStore{client: client, prefix: prefix}
+}
+
+func (s *RedisNonceStore) Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, s.prefix+":nonce:"+nonce, 1, ttl).Result()
+}
+
+// MemoryNonceStore keeps nonces in process memory. It is intended for tests and single replica setups.
+type MemoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	// evicted is the time of the last cleanup of expired nonces.
+	evicted time.Time
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: make(map[string]time.Time)}
+}
+
+func (s *MemoryNonceStore) Use(_ context.Context, nonce string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(s.evicted) > time.Minute {
+		for n, expires := range s.nonces {
+			if now.After(expires) {
+				delete(s.nonces, n)
+			}
+		}
+		s.evicted = now
+	}
+
+	if expires, ok := s.nonces[nonce]; ok && now.Before(expires) {
+		return false, nil
+	}
+
+	s.nonces[nonce] = now.Add(ttl)
+	return true, nil
+}
@@ -0,0 +1,281 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/models"
+	"github.com/iteais/sdk/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrApiAccountNotFound is returned by an AccountResolver for unknown keys.
+var ErrApiAccountNotFound = errors.New("api account not found")
+
+var (
+	hmacAccountLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "hmac_account_lookups_total",
+		Help: "HMAC account lookups by cache tier (local, redis, upstream) and result (hit, miss, negative).",
+	}, []string{"tier", "result"})
+
+	hmacUpstreamDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "hmac_account_upstream_duration_seconds",
+		Help:    "Duration of HMAC account requests to HMAC_SERVER.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+type hmacResponse struct {
+	Cnt   int
+	Data  models.ApiAccount
+	Error string
+}
+
+// AccountResolver finds an ApiAccount by its public key.
+type AccountResolver interface {
+	Resolve(ctx context.Context, key string) (*models.ApiAccount, error)
+}
+
+// HttpAccountResolver asks HMAC_SERVER + "/api/byKey/" for the account.
+type HttpAccountResolver struct {
+	checkHost string
+}
+
+func NewHttpAccountResolver(checkHost string) *HttpAccountResolver {
+	return &HttpAccountResolver{checkHost: checkHost}
+}
+
+func (r *HttpAccountResolver) Resolve(ctx context.Context, key string) (*models.ApiAccount, error) {
+	config := InternalFetchConfig{
+		Context: ctx,
+		Method:  "GET",
+		Url:     r.checkHost + "/api/byKey/" + key,
+	}
+	if c, ok := ctx.(*gin.Context); ok {
+		config.JWT = c.Request.Header.Get(utils.AuthHeader)
+		config.TraceId = c.GetString(TraceIdContextKey)
+	}
+
+	start := time.Now()
+	resp := InternalFetch(config)
+	hmacUpstreamDuration.Observe(time.Since(start).Seconds())
+
+	if resp == nil {
+		return nil, errors.New("cant call api service")
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrApiAccountNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("api service return status code: " + strconv.Itoa(resp.StatusCode))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var account hmacResponse
+	if err = json.Unmarshal(body, &account); err != nil {
+		return nil, err
+	}
+	if account.Data.Key == "" {
+		return nil, ErrApiAccountNotFound
+	}
+
+	return &account.Data, nil
+}
+
+// redisUnknownAccount is the Redis value of unknown keys, the only accounts shared through Redis.
+const redisUnknownAccount = "null"
+
+type CachedAccountResolverConfig struct {
+	// Size of the in-process LRU. Default 1000.
+	Size int
+	// TTL of found accounts. Default 1m.
+	TTL time.Duration
+	// NegativeTTL of unknown keys. Default 10s.
+	NegativeTTL time.Duration
+	// Timeout of a lookup shared by concurrent requests of the same key. Default 10s.
+	Timeout time.Duration
+	// Redis enables the shared cache of unknown keys and pub/sub invalidation. Found accounts carry
+	// the HMAC secret, so they are cached only in process memory and never in Redis.
+	Redis *redis.Client
+	// Prefix of Redis keys and of the invalidation channel.
+	Prefix string
+}
+
+// CachedAccountResolver caches accounts of the upstream resolver in process memory and unknown
+// keys optionally in Redis. Concurrent lookups of the same key share one upstream request.
+type CachedAccountResolver struct {
+	upstream AccountResolver
+	config   CachedAccountResolverConfig
+	local    *utils.LRU[string, *models.ApiAccount]
+	group    singleflight.Group
+}
+
+func NewCachedAccountResolver(upstream AccountResolver, config CachedAccountResolverConfig) *CachedAccountResolver {
+	if config.Size <= 0 {
+		config.Size = 1000
+	}
+	if config.TTL <= 0 {
+		config.TTL = time.Minute
+	}
+	if config.NegativeTTL <= 0 {
+		config.NegativeTTL = 10 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	return &CachedAccountResolver{
+		upstream: upstream,
+		config:   config,
+		local:    utils.NewLRU[string, *models.ApiAccount](config.Size),
+	}
+}
+
+func (r *CachedAccountResolver) Resolve(ctx context.Context, key string) (*models.ApiAccount, error) {
+	if account, ok := r.local.Get(key); ok {
+		return r.hit("local", account)
+	}
+	hmacAccountLookups.WithLabelValues("local", "miss").Inc()
+
+	result, err, _ := r.group.Do(key, func() (interface{}, error) {
+		// Результат общий для всех ждущих запросов: отключение первого клиента не должно его прерывать
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.config.Timeout)
+		defer cancel()
+
+		var account *models.ApiAccount
+		if r.unknownInRedis(ctx, key) {
+			r.local.Set(key, account, r.config.NegativeTTL)
+			return account, nil
+		}
+
+		account, err := r.upstream.Resolve(ctx, key)
+		if errors.Is(err, ErrApiAccountNotFound) {
+			account = nil
+			hmacAccountLookups.WithLabelValues("upstream", "negative").Inc()
+		} else if err != nil {
+			return nil, err
+		} else {
+			hmacAccountLookups.WithLabelValues("upstream", "hit").Inc()
+		}
+
+		r.local.Set(key, account, r.ttl(account))
+		if account == nil {
+			r.setUnknownInRedis(ctx, key)
+		}
+		return account, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	account := result.(*models.ApiAccount)
+	if account == nil {
+		return nil, ErrApiAccountNotFound
+	}
+	return account, nil
+}
+
+// Invalidate drops the key from all tiers and notifies other replicas.
+func (r *CachedAccountResolver) Invalidate(ctx context.Context, key string) error {
+	r.local.Delete(key)
+
+	if r.config.Redis == nil {
+		return nil
+	}
+
+	if err := r.config.Redis.Del(ctx, r.redisKey(key)).Err(); err != nil {
+		return err
+	}
+	return r.config.Redis.Publish(ctx, r.channel(), key).Err()
+}
+
+// Listen drops local entries invalidated by other replicas until ctx is done.
+func (r *CachedAccountResolver) Listen(ctx context.Context) {
+	if r.config.Redis == nil {
+		return
+	}
+
+	go func() {
+		pubsub := r.config.Redis.Subscribe(ctx, r.channel())
+		defer func() {
+			_ = pubsub.Close()
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-pubsub.Channel():
+				if !ok {
+					return
+				}
+				r.local.Delete(msg.Payload)
+			}
+		}
+	}()
+}
+
+func (r *CachedAccountResolver) hit(tier string, account *models.ApiAccount) (*models.ApiAccount, error) {
+	if account == nil {
+		hmacAccountLookups.WithLabelValues(tier, "negative").Inc()
+		return nil, ErrApiAccountNotFound
+	}
+	hmacAccountLookups.WithLabelValues(tier, "hit").Inc()
+	return account, nil
+}
+
+// unknownInRedis reports whether another replica cached key as unknown.
+func (r *CachedAccountResolver) unknownInRedis(ctx context.Context, key string) bool {
+	if r.config.Redis == nil {
+		return false
+	}
+
+	data, err := r.config.Redis.Get(ctx, r.redisKey(key)).Result()
+	if err != nil || data != redisUnknownAccount {
+		hmacAccountLookups.WithLabelValues("redis", "miss").Inc()
+		return false
+	}
+
+	hmacAccountLookups.WithLabelValues("redis", "negative").Inc()
+	return true
+}
+
+func (r *CachedAccountResolver) setUnknownInRedis(ctx context.Context, key string) {
+	if r.config.Redis == nil {
+		return
+	}
+	_ = r.config.Redis.Set(ctx, r.redisKey(key), redisUnknownAccount, r.config.NegativeTTL).Err()
+}
+
+func (r *CachedAccountResolver) ttl(account *models.ApiAccount) time.Duration {
+	if account == nil {
+		return r.config.NegativeTTL
+	}
+	return r.config.TTL
+}
+
+func (r *CachedAccountResolver) redisKey(key string) string {
+	return r.config.Prefix + ":hmac:account:" + key
+}
+
+func (r *CachedAccountResolver) channel() string {
+	return r.config.Prefix + ":hmac:invalidate"
+}
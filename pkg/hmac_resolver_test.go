@@ -0,0 +1,126 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/auth"
+	"github.com/iteais/sdk/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingResolver struct {
+	calls    atomic.Int32
+	accounts map[string]models.ApiAccount
+	delay    time.Duration
+}
+
+func (r *countingResolver) Resolve(ctx context.Context, key string) (*models.ApiAccount, error) {
+	r.calls.Add(1)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(r.delay):
+	}
+	if account, ok := r.accounts[key]; ok {
+		return &account, nil
+	}
+	return nil, ErrApiAccountNotFound
+}
+
+func TestCachedAccountResolver(t *testing.T) {
+	upstream := &countingResolver{
+		accounts: map[string]models.ApiAccount{"known": {ID: 1, Key: "known", Secret: "secret"}},
+		delay:    20 * time.Millisecond,
+	}
+	resolver := NewCachedAccountResolver(upstream, CachedAccountResolverConfig{})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			account, err := resolver.Resolve(ctx, "known")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), account.ID)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), upstream.calls.Load(), "concurrent lookups must be collapsed")
+
+	_, err := resolver.Resolve(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrApiAccountNotFound)
+	_, err = resolver.Resolve(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrApiAccountNotFound)
+	assert.Equal(t, int32(2), upstream.calls.Load(), "unknown keys must be cached")
+
+	assert.NoError(t, resolver.Invalidate(ctx, "known"))
+	_, err = resolver.Resolve(ctx, "known")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), upstream.calls.Load())
+}
+
+func TestCachedAccountResolverIgnoresFirstCallerCancel(t *testing.T) {
+	upstream := &countingResolver{
+		accounts: map[string]models.ApiAccount{"known": {ID: 1, Key: "known", Secret: "secret"}},
+		delay:    30 * time.Millisecond,
+	}
+	resolver := NewCachedAccountResolver(upstream, CachedAccountResolverConfig{})
+
+	// Первый клиент отключается, пока ждущие получают общий результат
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, _ = resolver.Resolve(ctx, "known")
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := resolver.Resolve(context.Background(), "known")
+		done <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	cancel()
+
+	assert.NoError(t, <-done)
+	assert.Equal(t, int32(1), upstream.calls.Load())
+}
+
+func TestAppendApiAccountInvalidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		setPrincipal(c, &auth.Principal{ApiAccount: &models.ApiAccount{Role: c.GetHeader("Role")}})
+	})
+
+	previous := App
+	App = &Application{
+		Router:      router,
+		ApiAccounts: NewCachedAccountResolver(&countingResolver{}, CachedAccountResolverConfig{}),
+		Policy:      auth.NewPolicy(auth.PolicyConfig{Roles: map[string][]string{"hmac": {ApiAccountInvalidatePermission}}}),
+	}
+	defer func() {
+		App = previous
+	}()
+	App.AppendApiAccountInvalidation()
+
+	call := func(role string) int {
+		r := httptest.NewRequest(http.MethodPost, strings.Replace(ApiAccountInvalidateEndpoint, ":key", "known", 1), nil)
+		r.Header.Set("Role", role)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, call("client"))
+	assert.Equal(t, http.StatusNoContent, call("hmac"))
+}
@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/iteais/sdk/pkg/models"
+	"github.com/iteais/sdk/pkg/utils"
+)
+
+// HmacSigner signs outgoing requests with the v2 scheme checked by HmacMiddleware.
+//
+//	InternalFetch(InternalFetchConfig{Method: "GET", Url: url, Signer: &HmacSigner{Key: key, Secret: secret}})
+type HmacSigner struct {
+	Key    string
+	Secret string
+}
+
+// Sign sets Api-Key, Api-Time, Api-Nonce, Api-Sign and Api-Sign-Version headers. The body is read and restored.
+func (s *HmacSigner) Sign(req *http.Request) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		_ = req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := uuid.New().String()
+	canonical := utils.CanonicalRequest(req.Method, req.URL.Path, req.URL.Query(), body, now, nonce)
+	account := models.ApiAccount{Key: s.Key, Secret: s.Secret}
+
+	req.Header.Set(ApiKeyHttpHeader, s.Key)
+	req.Header.Set(ApiTimeHttpHeader, now)
+	req.Header.Set(ApiNonceHttpHeader, nonce)
+	req.Header.Set(ApiSignHttpHeader, account.GetSignature(canonical))
+	req.Header.Set(ApiSignVersionHttpHeader, "2")
+
+	return nil
+}
+
+// Transport signs every request sent through base. Used by InternalFetch so that each retry
+// attempt gets a fresh time and nonce.
+func (s *HmacSigner) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &signingTransport{signer: s, base: base}
+}
+
+type signingTransport struct {
+	signer *HmacSigner
+	base   http.RoundTripper
+}
+
+func (t *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the original request.
+	signed := req.Clone(req.Context())
+	if err := t.signer.Sign(signed); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(signed)
+}
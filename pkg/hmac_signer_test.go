@@ -0,0 +1,236 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type staticResolver map[string]models.ApiAccount
+
+func (r staticResolver) Resolve(_ context.Context, key string) (*models.ApiAccount, error) {
+	if account, ok := r[key]; ok {
+		return &account, nil
+	}
+	return nil, ErrApiAccountNotFound
+}
+
+func newHmacTestRouter(config HmacConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	if config.Resolver == nil {
+		config.Resolver = staticResolver{"key": {ID: 1, Key: "key", Secret: "secret"}}
+	}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		// Not in the subnet of a local interface, so the signature is always checked.
+		c.Request.RemoteAddr = "203.0.113.10:1234"
+	}, HmacMiddlewareWithConfig(config))
+	router.POST("/user/:id", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func TestHmacSigner(t *testing.T) {
+	router := newHmacTestRouter(HmacConfig{})
+	signer := &HmacSigner{Key: "key", Secret: "secret"}
+
+	req := httptest.NewRequest(http.MethodPost, "/user/1?b=2&a=1", strings.NewReader(`{"name":"john"}`))
+	assert.NoError(t, signer.Sign(req))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	tampered := httptest.NewRequest(http.MethodPost, "/user/2?b=2&a=1", strings.NewReader(`{"name":"john"}`))
+	assert.NoError(t, signer.Sign(tampered))
+	tampered.URL.Path = "/user/1"
+	tampered.Body = http.NoBody
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, tampered)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	unknown := httptest.NewRequest(http.MethodPost, "/user/1", nil)
+	assert.NoError(t, (&HmacSigner{Key: "other", Secret: "secret"}).Sign(unknown))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, unknown)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestHmacMiddleware_MaxBodySize(t *testing.T) {
+	router := newHmacTestRouter(HmacConfig{MaxBodySize: 16})
+	signer := &HmacSigner{Key: "key", Secret: "secret"}
+
+	req := httptest.NewRequest(http.MethodPost, "/user/1", strings.NewReader(`{"name":"john"}`))
+	assert.NoError(t, signer.Sign(req))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/user/1", strings.NewReader(`{"name":"john smith"}`))
+	assert.NoError(t, signer.Sign(req))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestHmacMiddleware_V1(t *testing.T) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	account := models.ApiAccount{Key: "key", Secret: "secret"}
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/user/1", nil)
+		req.Header.Set(ApiKeyHttpHeader, "key")
+		req.Header.Set(ApiTimeHttpHeader, now)
+		req.Header.Set(ApiSignHttpHeader, account.GetHash(now))
+		return req
+	}
+
+	w := httptest.NewRecorder()
+	newHmacTestRouter(HmacConfig{}).ServeHTTP(w, newRequest())
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	newHmacTestRouter(HmacConfig{DisableV1: true}).ServeHTTP(w, newRequest())
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestHmacMiddleware_Replay(t *testing.T) {
+	router := newHmacTestRouter(HmacConfig{})
+	signer := &HmacSigner{Key: "key", Secret: "secret"}
+
+	req := httptest.NewRequest(http.MethodPost, "/user/1", nil)
+	assert.NoError(t, signer.Sign(req))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	replay := httptest.NewRequest(http.MethodPost, "/user/1", nil)
+	replay.Header = req.Header.Clone()
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, replay)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	stripped := httptest.NewRequest(http.MethodPost, "/user/1", nil)
+	stripped.Header = req.Header.Clone()
+	stripped.Header.Del(ApiNonceHttpHeader)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, stripped)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "nonce is a part of the v2 signature")
+}
+
+func TestHmacMiddleware_ClockSkew(t *testing.T) {
+	old := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	account := models.ApiAccount{Key: "key", Secret: "secret"}
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/user/1", nil)
+		req.Header.Set(ApiKeyHttpHeader, "key")
+		req.Header.Set(ApiTimeHttpHeader, old)
+		req.Header.Set(ApiSignHttpHeader, account.GetHash(old))
+		return req
+	}
+
+	w := httptest.NewRecorder()
+	newHmacTestRouter(HmacConfig{}).ServeHTTP(w, newRequest())
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	newHmacTestRouter(HmacConfig{ClockSkew: 30 * time.Second}).ServeHTTP(w, newRequest())
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestApiRoleMiddleware(t *testing.T) {
+	router := newHmacTestRouter(HmacConfig{Resolver: staticResolver{
+		"service": {ID: 1, Key: "service", Secret: "secret", Role: "service"},
+		"client":  {ID: 2, Key: "client", Secret: "secret", Role: "client"},
+		"scoped":  {ID: 3, Key: "scoped", Secret: "secret", Role: "service", Scopes: []models.ApiScope{{Path: "^/user/"}}},
+	}})
+	router.POST("/internal", ApiRoleMiddleware("service"), func(c *gin.Context) {
+		account, _ := c.Get(ApiAccountContextKey)
+		assert.Empty(t, account.(models.ApiAccount).Secret)
+		c.Status(http.StatusOK)
+	})
+
+	do := func(key string) int {
+		req := httptest.NewRequest(http.MethodPost, "/internal", nil)
+		assert.NoError(t, (&HmacSigner{Key: key, Secret: "secret"}).Sign(req))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, do("service"))
+	assert.Equal(t, http.StatusForbidden, do("client"))
+	// The scope only allows /user/ routes.
+	assert.Equal(t, http.StatusForbidden, do("scoped"))
+}
+
+func TestHmacMiddleware_TrustedNetworks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	do := func(config HmacConfig, remoteAddr string, forwardedFor string) *httptest.ResponseRecorder {
+		config.Resolver = staticResolver{}
+		router := gin.New()
+		_ = router.SetTrustedProxies([]string{"10.0.0.1"})
+		router.Use(HmacMiddlewareWithConfig(config))
+		router.GET("/user", func(c *gin.Context) {
+			c.String(http.StatusOK, c.GetString(HmacBypassContextKey))
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/user", nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	trusted := HmacConfig{TrustedNetworks: []string{"172.16.0.0/12", "fd00::/8"}}
+
+	w := do(trusted, "172.16.5.5:1234", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "172.16.0.0/12", w.Body.String())
+
+	assert.Equal(t, http.StatusOK, do(trusted, "[fd00::5]:1234", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(trusted, "127.0.0.1:1234", "").Code)
+
+	// Forwarded headers are only used from trusted proxies.
+	assert.Equal(t, http.StatusOK, do(trusted, "10.0.0.1:1234", "172.16.5.5").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(trusted, "203.0.113.10:1234", "172.16.5.5").Code)
+
+	// Без TrustedNetworks подпись проверяется и у локальных клиентов
+	assert.Equal(t, http.StatusUnauthorized, do(HmacConfig{}, "127.0.0.1:1234", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(HmacConfig{TrustedNetworks: []string{"127.0.0.1"}, DisableTrustedBypass: true}, "127.0.0.1:1234", "").Code)
+}
+
+func TestHmacMiddleware_BuiltinWhiteList(t *testing.T) {
+	router := newHmacTestRouter(HmacConfig{})
+	for _, path := range []string{HealthEndpoint, LiveEndpoint, HealthReportEndpoint} {
+		router.GET(path, func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+	}
+
+	call := func(path string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, call(HealthEndpoint))
+	assert.Equal(t, http.StatusOK, call(LiveEndpoint))
+	assert.Equal(t, http.StatusUnauthorized, call(HealthReportEndpoint))
+}
@@ -2,11 +2,17 @@ package pkg
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/iteais/sdk/pkg/models"
+	"github.com/iteais/sdk/pkg/tracing"
 	"github.com/iteais/sdk/pkg/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	"math"
 	"net/http"
@@ -16,11 +22,15 @@ import (
 )
 
 type InternalFetchConfig struct {
+	// Context of the request, e.g. c.Request.Context(). Its span is the parent of the request spans.
+	Context context.Context
 	Method  string
 	Url     string
 	Body    string
 	JWT     string
 	TraceId string
+	// Signer adds v2 HMAC signature headers to the request.
+	Signer *HmacSigner
 }
 
 func FetchUserById(id int64, traceId string, jwt string) (models.User, error) {
@@ -102,19 +112,43 @@ func FetchEventById(id int64, traceId string, jwt string) (models.Event, error)
 
 func InternalFetch(config InternalFetchConfig) *http.Response {
 	App.Log.Info("Internal fetching " + config.Method + " " + config.Url)
+
+	ctx := config.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := tracing.Tracer().Start(ctx, "InternalFetch "+config.Method,
+		trace.WithAttributes(attribute.String("url.full", config.Url)))
+	defer span.End()
+
+	if config.TraceId == "" {
+		config.TraceId = tracing.TraceId(ctx)
+	}
+
+	start := time.Now()
+
+	var transport http.RoundTripper = &http.Transport{}
+	if config.Signer != nil {
+		transport = config.Signer.Transport(transport)
+	}
+	// Span на каждую попытку RetryableTransport
+	transport = tracing.NewTransport(sentryTransport{base: transport})
+
 	client := &http.Client{
-		Transport: NewRetryableTransport(nil, 3, 1*time.Second, config.TraceId), // 3 retries, 1s initial delay
-		Timeout:   10 * time.Second,                                             // Set a timeout for the request
+		Transport: NewRetryableTransport(transport, 3, 1*time.Second, config.TraceId), // 3 retries, 1s initial delay
+		Timeout:   10 * time.Second,                                                   // Set a timeout for the request
 	}
 
-	req, err := http.NewRequest(config.Method, config.Url, nil)
+	req, err := http.NewRequestWithContext(ctx, config.Method, config.Url, nil)
 
 	if config.Body != "" {
-		req, err = http.NewRequest(config.Method, config.Url, strings.NewReader(config.Body))
+		req, err = http.NewRequestWithContext(ctx, config.Method, config.Url, strings.NewReader(config.Body))
 	}
 
 	if err != nil {
 		App.Log.WithField(TraceIdContextKey, config.TraceId).Println("Error creating request:", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return nil
 	}
 	req.Header.Set("Content-Type", "application/json")
@@ -126,10 +160,16 @@ func InternalFetch(config InternalFetchConfig) *http.Response {
 
 	resp, err := client.Do(req)
 	if err != nil {
+		observeInternalFetch(config.Url, config.Method, 0, start)
 		App.Log.WithField(TraceIdContextKey, config.TraceId).Println("Error making "+config.Method+" request:", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return nil
 	}
 
+	observeInternalFetch(config.Url, config.Method, resp.StatusCode, start)
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+
 	return resp
 }
 
@@ -172,7 +212,7 @@ func (t *RetryableTransport) RoundTrip(req *http.Request) (*http.Response, error
 			req.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 		}
 
-		resp, err := t.transport.RoundTrip(req)
+		resp, err := t.transport.RoundTrip(req.WithContext(tracing.WithResendCount(req.Context(), i)))
 
 		if err == nil && !shouldRetryStatusCode(resp.StatusCode) {
 			return resp, nil // Success or non-retryable status
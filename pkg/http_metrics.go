@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// UnmatchedRoute is the route label of requests without a route, so 404 scans do not create new series.
+const UnmatchedRoute = "unmatched"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route template and status class (2xx, 4xx, 5xx).",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request duration by method, route template and status class.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	httpInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests being processed by method and route template.",
+	}, []string{"method", "route"})
+
+	internalFetchRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "internal_fetch_requests_total",
+		Help: "InternalFetch requests by target host, method and status class, status is error if no response was received.",
+	}, []string{"target", "method", "status"})
+
+	internalFetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "internal_fetch_duration_seconds",
+		Help:    "InternalFetch duration including retries by target host.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"target", "method"})
+)
+
+// MetricsMiddleware records RED metrics of requests labelled by c.FullPath(), not the raw path.
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = UnmatchedRoute
+		}
+		method := c.Request.Method
+
+		inFlight := httpInFlight.WithLabelValues(method, route)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		c.Next()
+
+		status := statusClass(c.Writer.Status())
+		httpRequests.WithLabelValues(method, route, status).Inc()
+		httpDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return strconv.Itoa(code)
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// observeInternalFetch records an InternalFetch call, code is 0 if no response was received.
+func observeInternalFetch(rawUrl string, method string, code int, start time.Time) {
+	target := rawUrl
+	if u, err := url.Parse(rawUrl); err == nil && u.Host != "" {
+		target = u.Host
+	}
+
+	status := "error"
+	if code != 0 {
+		status = statusClass(code)
+	}
+
+	internalFetchRequests.WithLabelValues(target, method, status).Inc()
+	internalFetchDuration.WithLabelValues(target, method).Observe(time.Since(start).Seconds())
+}
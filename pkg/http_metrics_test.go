@@ -0,0 +1,51 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(MetricsMiddleware())
+	router.GET("/metrics-test/:id", func(c *gin.Context) {
+		assert.Equal(t, 1.0, testutil.ToFloat64(httpInFlight.WithLabelValues(http.MethodGet, "/metrics-test/:id")))
+		if c.Param("id") == "0" {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	for _, path := range []string{"/metrics-test/1", "/metrics-test/2", "/metrics-test/0", "/wp-login.php"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// Метки по шаблону маршрута, а не по пути
+	assert.Equal(t, 2.0, testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/metrics-test/:id", "2xx")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/metrics-test/:id", "4xx")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, UnmatchedRoute, "4xx")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(httpInFlight.WithLabelValues(http.MethodGet, "/metrics-test/:id")))
+}
+
+func TestStatusClass(t *testing.T) {
+	assert.Equal(t, "2xx", statusClass(http.StatusNoContent))
+	assert.Equal(t, "5xx", statusClass(http.StatusBadGateway))
+	assert.Equal(t, "0", statusClass(0))
+}
+
+func TestObserveInternalFetch(t *testing.T) {
+	observeInternalFetch("http://user-service:8080/user/1", http.MethodGet, http.StatusOK, time.Now())
+	observeInternalFetch("http://user-service:8080/user/2", http.MethodGet, 0, time.Now())
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(internalFetchRequests.WithLabelValues("user-service:8080", http.MethodGet, "2xx")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(internalFetchRequests.WithLabelValues("user-service:8080", http.MethodGet, "error")))
+}
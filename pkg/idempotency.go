@@ -0,0 +1,404 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/models"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+	"github.com/uptrace/bun"
+)
+
+const (
+	IdempotencyKeyHttpHeader      = "Idempotency-Key"
+	IdempotencyReplayedHttpHeader = "Idempotent-Replayed"
+
+	// defaultMaxIdempotentBody limits bodies of requests with Idempotency-Key, they are read to compare retries.
+	defaultMaxIdempotentBody = 10 << 20
+)
+
+// IdempotencyRecord is the stored state of a request. Status is 0 while the request is in flight.
+type IdempotencyRecord struct {
+	BodyHash    string `json:"body_hash"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+type IdempotencyStore interface {
+	// Reserve atomically saves record if key is free. Otherwise the existing record is returned and ok is false.
+	Reserve(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) (existing *IdempotencyRecord, ok bool, err error)
+	// Save overwrites the record for key.
+	Save(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+type IdempotencyConfig struct {
+	// Store is set by NewApplication to Redis when REDIS_HOST is set and to Postgres otherwise.
+	// Without it records are kept in process memory and are not shared between replicas.
+	Store IdempotencyStore
+	// Retention is how long responses are replayed. Default 24h.
+	Retention time.Duration
+	// LockTimeout is how long an in-flight request blocks duplicates, e.g. if the pod died. Default 1m.
+	LockTimeout time.Duration
+	// Methods that support the header. Default POST and PATCH.
+	Methods []string
+	// MaxBodySize of requests with Idempotency-Key, larger requests get 413. Default 10MB.
+	MaxBodySize int64
+}
+
+// IdempotencyMiddleware stores the first response for an Idempotency-Key of the current user and route
+// and replays it for retries. A concurrent duplicate gets 409, a retry with another body gets 422.
+// 5xx responses are not stored so the client can retry them.
+func IdempotencyMiddleware(config IdempotencyConfig) gin.HandlerFunc {
+	if config.Store == nil {
+		log.Warn("idempotency store is not configured, Idempotency-Key works only within one replica")
+		config.Store = NewMemoryIdempotencyStore()
+	}
+	if config.Retention <= 0 {
+		config.Retention = 24 * time.Hour
+	}
+	if config.LockTimeout <= 0 {
+		config.LockTimeout = time.Minute
+	}
+	if len(config.Methods) == 0 {
+		config.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = defaultMaxIdempotentBody
+	}
+
+	return func(c *gin.Context) {
+		idempotencyKey := c.GetHeader(IdempotencyKeyHttpHeader)
+		if idempotencyKey == "" || !slices.Contains(config.Methods, c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		body, ok := readBody(c, config.MaxBodySize)
+		if !ok {
+			return
+		}
+
+		bodyHash := sha256.Sum256(body)
+		record := IdempotencyRecord{BodyHash: hex.EncodeToString(bodyHash[:])}
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		keyHash := sha256.Sum256([]byte(idempotencyOwner(c) + "\n" + c.Request.Method + " " + route + "\n" + idempotencyKey))
+		key := hex.EncodeToString(keyHash[:])
+
+		existing, ok, err := config.Store.Reserve(c, key, record, config.LockTimeout)
+		if err != nil {
+			App.GetRequestLogger(c).Warn("idempotency store error: ", err)
+			c.Next()
+			return
+		}
+
+		if !ok {
+			switch {
+			case existing.BodyHash != record.BodyHash:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"message": "Idempotency-Key is already used with another request body"})
+			case existing.Status == 0:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": "Request with this Idempotency-Key is in progress"})
+			default:
+				c.Header(IdempotencyReplayedHttpHeader, "true")
+				c.Data(existing.Status, existing.ContentType, existing.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		writer := &bodyCaptureWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		defer func() {
+			// Store operations must finish even if the client went away.
+			ctx := context.WithoutCancel(c.Request.Context())
+
+			if r := recover(); r != nil {
+				_ = config.Store.Delete(ctx, key)
+				panic(r)
+			}
+
+			status := c.Writer.Status()
+			if status >= http.StatusInternalServerError {
+				_ = config.Store.Delete(ctx, key)
+				return
+			}
+
+			record.Status = status
+			record.ContentType = c.Writer.Header().Get("Content-Type")
+			record.Body = writer.body.Bytes()
+
+			if err := config.Store.Save(ctx, key, record, config.Retention); err != nil {
+				App.GetRequestLogger(c).Warn("idempotency store error: ", err)
+			}
+		}()
+
+		c.Next()
+	}
+}
+
+func idempotencyOwner(c *gin.Context) string {
+	if user, ok := c.Get(UserContextKey); ok {
+		if u, ok := user.(models.User); ok {
+			return "user:" + strconv.FormatInt(u.ID, 10)
+		}
+	}
+	if key := c.GetHeader("Api-Key"); key != "" {
+		return "key:" + key
+	}
+	return "ip:" + c.ClientIP()
+}
+
+type bodyCaptureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyCaptureWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyCaptureWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// RedisIdempotencyStore keeps records in Redis under <prefix>:idempotency:<key>.
+type RedisIdempotencyStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisIdempotencyStore(client *redis.Client, prefix string) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{client: client, prefix: prefix}
+}
+
+func (s *RedisIdempotencyStore) Reserve(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ok, err := s.client.SetNX(ctx, s.key(key), data, ttl).Result()
+	if err != nil || ok {
+		return nil, ok, err
+	}
+
+	stored, err := s.client.Get(ctx, s.key(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// Expired in between, try again.
+		return s.Reserve(ctx, key, record, ttl)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var existing IdempotencyRecord
+	if err = json.Unmarshal(stored, &existing); err != nil {
+		return nil, false, err
+	}
+	return &existing, false, nil
+}
+
+func (s *RedisIdempotencyStore) Save(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.key(key), data, ttl).Err()
+}
+
+func (s *RedisIdempotencyStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.key(key)).Err()
+}
+
+func (s *RedisIdempotencyStore) key(key string) string {
+	return s.prefix + ":idempotency:" + key
+}
+
+type idempotencyRow struct {
+	bun.BaseModel `bun:"table:sdk_idempotency_keys"`
+
+	Key         string `bun:",pk"`
+	BodyHash    string `bun:",notnull"`
+	Status      int    `bun:",notnull"`
+	ContentType string `bun:",notnull"`
+	Body        []byte
+	ExpiresAt   time.Time `bun:",notnull"`
+}
+
+func newIdempotencyRow(key string, record IdempotencyRecord, expiresAt time.Time) *idempotencyRow {
+	return &idempotencyRow{Key: key, BodyHash: record.BodyHash, Status: record.Status,
+		ContentType: record.ContentType, Body: record.Body, ExpiresAt: expiresAt}
+}
+
+func (r *idempotencyRow) record() *IdempotencyRecord {
+	return &IdempotencyRecord{BodyHash: r.BodyHash, Status: r.Status, ContentType: r.ContentType, Body: r.Body}
+}
+
+// PgIdempotencyStore keeps records in the sdk_idempotency_keys table, created on first use.
+// Expired records are deleted by Cleanup, NewApplication schedules it hourly.
+type PgIdempotencyStore struct {
+	db     *bun.DB
+	initMu sync.Mutex
+	inited bool
+}
+
+func NewPgIdempotencyStore(db *bun.DB) *PgIdempotencyStore {
+	return &PgIdempotencyStore{db: db}
+}
+
+// init creates the table, a failed attempt is retried on the next call.
+func (s *PgIdempotencyStore) init(ctx context.Context) error {
+	s.initMu.Lock()
+	defer s.initMu.Unlock()
+	if s.inited {
+		return nil
+	}
+
+	// Отмена запроса, который первым создает таблицу, не должна прерывать DDL
+	if _, err := s.db.NewCreateTable().Model((*idempotencyRow)(nil)).IfNotExists().Exec(context.WithoutCancel(ctx)); err != nil {
+		return err
+	}
+	s.inited = true
+	return nil
+}
+
+func (s *PgIdempotencyStore) Reserve(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	if err := s.init(ctx); err != nil {
+		return nil, false, err
+	}
+
+	for {
+		now := time.Now()
+		row := newIdempotencyRow(key, record, now.Add(ttl))
+
+		// Истекшую запись занимает новый запрос
+		res, err := s.db.NewInsert().Model(row).
+			On("CONFLICT (key) DO UPDATE").
+			Set("body_hash = EXCLUDED.body_hash, status = EXCLUDED.status, content_type = EXCLUDED.content_type").
+			Set("body = EXCLUDED.body, expires_at = EXCLUDED.expires_at").
+			Where("?TableAlias.expires_at <= ?", now).
+			Exec(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		if affected, err := res.RowsAffected(); err != nil || affected == 1 {
+			return nil, err == nil, err
+		}
+
+		existing := &idempotencyRow{}
+		err = s.db.NewSelect().Model(existing).Where("key = ?", key).Where("expires_at > ?", now).Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Запись истекла или удалена между запросами
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return existing.record(), false, nil
+	}
+}
+
+func (s *PgIdempotencyStore) Save(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error {
+	if err := s.init(ctx); err != nil {
+		return err
+	}
+
+	row := newIdempotencyRow(key, record, time.Now().Add(ttl))
+	_, err := s.db.NewInsert().Model(row).
+		On("CONFLICT (key) DO UPDATE").
+		Set("body_hash = EXCLUDED.body_hash, status = EXCLUDED.status, content_type = EXCLUDED.content_type").
+		Set("body = EXCLUDED.body, expires_at = EXCLUDED.expires_at").
+		Exec(ctx)
+	return err
+}
+
+func (s *PgIdempotencyStore) Delete(ctx context.Context, key string) error {
+	if err := s.init(ctx); err != nil {
+		return err
+	}
+	_, err := s.db.NewDelete().Model((*idempotencyRow)(nil)).Where("key = ?", key).Exec(ctx)
+	return err
+}
+
+// Cleanup deletes expired records.
+func (s *PgIdempotencyStore) Cleanup(ctx context.Context) error {
+	if err := s.init(ctx); err != nil {
+		return err
+	}
+	_, err := s.db.NewDelete().Model((*idempotencyRow)(nil)).Where("expires_at <= ?", time.Now()).Exec(ctx)
+	return err
+}
+
+// MemoryIdempotencyStore keeps records in process memory. It is intended for tests and single replica setups.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]memoryIdempotencyRecord
+}
+
+type memoryIdempotencyRecord struct {
+	record  IdempotencyRecord
+	expires time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: make(map[string]memoryIdempotencyRecord)}
+}
+
+func (s *MemoryIdempotencyStore) Reserve(_ context.Context, key string, record IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evict()
+
+	if existing, ok := s.records[key]; ok {
+		return &existing.record, false, nil
+	}
+
+	s.records[key] = memoryIdempotencyRecord{record: record, expires: time.Now().Add(ttl)}
+	return nil, true, nil
+}
+
+func (s *MemoryIdempotencyStore) Save(_ context.Context, key string, record IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[key] = memoryIdempotencyRecord{record: record, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) evict() {
+	now := time.Now()
+	for key, record := range s.records {
+		if now.After(record.expires) {
+			delete(s.records, key)
+		}
+	}
+}
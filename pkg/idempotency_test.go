@@ -0,0 +1,137 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	router := gin.New()
+	router.Use(IdempotencyMiddleware(IdempotencyConfig{}))
+	router.POST("/user", func(c *gin.Context) {
+		calls.Add(1)
+		if c.Query("slow") != "" {
+			<-release
+		}
+		c.JSON(http.StatusCreated, gin.H{"id": calls.Load()})
+	})
+
+	do := func(key string, body string, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/user"+query, strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHttpHeader, key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := do("a", `{"name":"john"}`, "")
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	replay := do("a", `{"name":"john"}`, "")
+	assert.Equal(t, http.StatusCreated, replay.Code)
+	assert.Equal(t, first.Body.String(), replay.Body.String())
+	assert.Equal(t, "true", replay.Header().Get(IdempotencyReplayedHttpHeader))
+	assert.Equal(t, int32(1), calls.Load())
+
+	assert.Equal(t, http.StatusUnprocessableEntity, do("a", `{"name":"jane"}`, "").Code)
+
+	done := make(chan struct{})
+	go func() {
+		do("b", `{}`, "?slow=1")
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, http.StatusConflict, do("b", `{}`, "?slow=1").Code)
+	close(release)
+	<-done
+
+	assert.Equal(t, http.StatusCreated, do("", `{}`, "").Code)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestIdempotencyMiddleware_MaxBodySize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(IdempotencyMiddleware(IdempotencyConfig{Store: NewMemoryIdempotencyStore(), MaxBodySize: 16}))
+	router.POST("/user", func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	do := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/user", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHttpHeader, "a")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, do(`{"name":"john smith"}`))
+	assert.Equal(t, http.StatusCreated, do(`{"name":"john"}`))
+}
+
+func TestPgIdempotencyStore(t *testing.T) {
+	sqldb, err := sql.Open(sqliteshim.ShimName, "file::memory:")
+	require.NoError(t, err)
+	sqldb.SetMaxOpenConns(1)
+	db := bun.NewDB(sqldb, sqlitedialect.New())
+	defer db.Close()
+
+	store := NewPgIdempotencyStore(db)
+	ctx := context.Background()
+
+	_, ok, err := store.Reserve(ctx, "a", IdempotencyRecord{BodyHash: "h"}, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	existing, ok, err := store.Reserve(ctx, "a", IdempotencyRecord{BodyHash: "other"}, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "h", existing.BodyHash)
+	assert.Zero(t, existing.Status)
+
+	record := IdempotencyRecord{BodyHash: "h", Status: http.StatusCreated, ContentType: "application/json", Body: []byte(`{"id":1}`)}
+	require.NoError(t, store.Save(ctx, "a", record, time.Minute))
+	existing, ok, err = store.Reserve(ctx, "a", IdempotencyRecord{BodyHash: "h"}, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, &record, existing)
+
+	// Истекшую запись занимает новый запрос
+	_, ok, err = store.Reserve(ctx, "expired", IdempotencyRecord{BodyHash: "h"}, time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	time.Sleep(5 * time.Millisecond)
+	_, ok, err = store.Reserve(ctx, "expired", IdempotencyRecord{BodyHash: "other"}, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	require.NoError(t, store.Delete(ctx, "a"))
+	_, ok, err = store.Reserve(ctx, "a", IdempotencyRecord{BodyHash: "h"}, time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, store.Cleanup(ctx))
+	count, err := db.NewSelect().Model((*idempotencyRow)(nil)).Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrDuplicate is returned by Enqueue when a job with the same unique key is still pending.
+var ErrDuplicate = errors.New("jobs: duplicate unique key")
+
+// Job is a unit of work stored in a Backend.
+type Job struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Payload     json.RawMessage `json:"payload"`
+	Priority    int             `json:"priority"`
+	UniqueKey   string          `json:"unique_key,omitempty"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+	LastError   string          `json:"last_error,omitempty"`
+}
+
+// Backend stores jobs between enqueue and execution.
+type Backend interface {
+	// Push stores a new job. It returns ErrDuplicate if job.UniqueKey is taken by a pending job.
+	Push(ctx context.Context, job *Job) error
+	// Pop returns the due job with the highest priority or nil if there is none.
+	Pop(ctx context.Context) (*Job, error)
+	// Ack removes a successfully processed job.
+	Ack(ctx context.Context, job *Job) error
+	// Retry stores the failed job again to be run at job.RunAt.
+	Retry(ctx context.Context, job *Job) error
+	// Kill moves the job to the dead-letter queue.
+	Kill(ctx context.Context, job *Job) error
+	// Dead returns up to limit jobs from the dead-letter queue, newest first.
+	Dead(ctx context.Context, limit int) ([]*Job, error)
+}
+
+// Leaser is implemented by backends which return a popped job to the queue when it is not acked
+// within the lease. Manager extends the lease every third of it while the handler runs.
+type Leaser interface {
+	Lease() time.Duration
+	// Extend renews the lease of a running job.
+	Extend(ctx context.Context, job *Job) error
+}
+
+type enqueueOptions struct {
+	delay       time.Duration
+	priority    int
+	uniqueKey   string
+	maxAttempts int
+}
+
+// EnqueueOption configures a single Enqueue call.
+type EnqueueOption func(*enqueueOptions)
+
+// WithDelay postpones the first run of the job.
+func WithDelay(d time.Duration) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.delay = d
+	}
+}
+
+// WithPriority sets the job priority. Jobs with higher priority run first.
+func WithPriority(p int) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.priority = p
+	}
+}
+
+// WithUniqueKey prevents enqueueing another job with the same key while this one is pending.
+func WithUniqueKey(key string) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.uniqueKey = key
+	}
+}
+
+// WithMaxAttempts overrides Config.MaxAttempts for the job.
+func WithMaxAttempts(n int) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.maxAttempts = n
+	}
+}
@@ -0,0 +1,320 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Handler processes a raw job payload.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+type Config struct {
+	// Workers is the number of concurrent workers. Default 4.
+	Workers int
+	// PollInterval is how long an idle worker waits before polling the backend again. Default 1s.
+	PollInterval time.Duration
+	// MaxAttempts is how many times a job is run before it is moved to the dead-letter queue. Default 5.
+	MaxAttempts int
+	// BackoffBase is the delay before the first retry, doubled for each next attempt. Default 1s.
+	BackoffBase time.Duration
+	// BackoffMax caps the retry delay. Default 10m.
+	BackoffMax time.Duration
+}
+
+// Manager registers job handlers, enqueues jobs and runs the worker pool.
+type Manager struct {
+	backend  Backend
+	config   Config
+	logger   logrus.FieldLogger
+	mu       sync.RWMutex
+	handlers map[string]Handler
+
+	cancel  context.CancelFunc
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	running bool
+}
+
+func NewManager(backend Backend, config Config, logger logrus.FieldLogger) *Manager {
+	if config.Workers <= 0 {
+		config.Workers = 4
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.BackoffBase <= 0 {
+		config.BackoffBase = time.Second
+	}
+	if config.BackoffMax <= 0 {
+		config.BackoffMax = 10 * time.Minute
+	}
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+
+	return &Manager{
+		backend:  backend,
+		config:   config,
+		logger:   logger,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Backend returns the storage used by the manager.
+func (m *Manager) Backend() Backend {
+	return m.backend
+}
+
+// Handle registers a handler for raw payloads. Prefer Register for typed payloads.
+func (m *Manager) Handle(name string, handler Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.handlers[name] = handler
+}
+
+// Register registers a handler which receives the payload decoded into T.
+func Register[T any](m *Manager, name string, handler func(ctx context.Context, payload T) error) {
+	m.Handle(name, func(ctx context.Context, raw json.RawMessage) error {
+		var payload T
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return fmt.Errorf("decode payload: %w", err)
+		}
+		return handler(ctx, payload)
+	})
+}
+
+// Enqueue stores a job for the named handler. The payload is encoded as JSON.
+func (m *Manager) Enqueue(ctx context.Context, name string, payload any, opts ...EnqueueOption) (*Job, error) {
+	options := enqueueOptions{maxAttempts: m.config.MaxAttempts}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &Job{
+		ID:          uuid.New().String(),
+		Name:        name,
+		Payload:     data,
+		Priority:    options.priority,
+		UniqueKey:   options.uniqueKey,
+		MaxAttempts: options.maxAttempts,
+		RunAt:       now.Add(options.delay),
+		CreatedAt:   now,
+	}
+
+	if err = m.backend.Push(ctx, job); err != nil {
+		return nil, err
+	}
+
+	enqueuedTotal.WithLabelValues(name).Inc()
+	return job, nil
+}
+
+// Start launches the worker pool. It is a no-op if the pool is already running.
+func (m *Manager) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.running {
+		return
+	}
+
+	var ctx context.Context
+	ctx, m.cancel = context.WithCancel(context.Background())
+	m.stop = make(chan struct{})
+	m.running = true
+
+	for i := 0; i < m.config.Workers; i++ {
+		m.wg.Add(1)
+		go m.work(ctx, m.stop)
+	}
+}
+
+// Stop stops fetching new jobs and waits for running ones to finish. When ctx expires
+// the contexts of running handlers are cancelled and ctx.Err() is returned without waiting
+// for them: the lease of a handler that ignores ctx expires and the job is delivered again.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.running {
+		m.mu.Unlock()
+		return nil
+	}
+	m.running = false
+	close(m.stop)
+	cancel := m.cancel
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		cancel()
+		return nil
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	}
+}
+
+func (m *Manager) work(ctx context.Context, stop <-chan struct{}) {
+	defer m.wg.Done()
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		job, err := m.backend.Pop(ctx)
+		if err != nil {
+			m.logger.WithError(err).Error("jobs: pop failed")
+		}
+
+		if job == nil {
+			select {
+			case <-stop:
+				return
+			case <-time.After(m.config.PollInterval):
+			}
+			continue
+		}
+
+		m.process(ctx, job)
+	}
+}
+
+func (m *Manager) process(ctx context.Context, job *Job) {
+	m.mu.RLock()
+	handler, ok := m.handlers[job.Name]
+	m.mu.RUnlock()
+
+	logger := m.logger.WithFields(logrus.Fields{"job": job.Name, "jobId": job.ID})
+
+	job.Attempts++
+
+	if !ok {
+		job.LastError = "no handler registered"
+		m.kill(ctx, job, logger)
+		return
+	}
+
+	inFlight.Inc()
+	start := time.Now()
+	stopHeartbeat := m.heartbeat(ctx, job, logger)
+	err := m.call(ctx, handler, job)
+	stopHeartbeat()
+	duration.WithLabelValues(job.Name).Observe(time.Since(start).Seconds())
+	inFlight.Dec()
+
+	// Backend operations must complete even if the worker is being cancelled.
+	ctx = context.WithoutCancel(ctx)
+
+	if err == nil {
+		processedTotal.WithLabelValues(job.Name, "success").Inc()
+		if err = m.backend.Ack(ctx, job); err != nil {
+			logger.WithError(err).Error("jobs: ack failed")
+		}
+		return
+	}
+
+	job.LastError = err.Error()
+
+	if job.Attempts >= job.MaxAttempts {
+		m.kill(ctx, job, logger)
+		return
+	}
+
+	job.RunAt = time.Now().Add(m.backoff(job.Attempts))
+	processedTotal.WithLabelValues(job.Name, "retry").Inc()
+	logger.WithError(err).Warnf("jobs: attempt %d failed, retry at %s", job.Attempts, job.RunAt.Format(time.RFC3339))
+
+	if err = m.backend.Retry(ctx, job); err != nil {
+		logger.WithError(err).Error("jobs: retry failed")
+	}
+}
+
+// heartbeat extends the lease of a Leaser backend until the returned function is called,
+// so a long job is not handed to another worker while it is still running.
+func (m *Manager) heartbeat(ctx context.Context, job *Job, logger logrus.FieldLogger) func() {
+	leaser, ok := m.backend.(Leaser)
+	if !ok || leaser.Lease() <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(leaser.Lease() / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			// После отмены в Stop аренда больше не продлевается, задачу получит другой воркер
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := leaser.Extend(context.WithoutCancel(ctx), job); err != nil {
+					logger.WithError(err).Warn("jobs: lease extension failed")
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (m *Manager) call(ctx context.Context, handler Handler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return handler(ctx, job.Payload)
+}
+
+func (m *Manager) kill(ctx context.Context, job *Job, logger logrus.FieldLogger) {
+	processedTotal.WithLabelValues(job.Name, "dead").Inc()
+	logger.WithError(errors.New(job.LastError)).Errorf("jobs: moved to dead-letter queue after %d attempts", job.Attempts)
+
+	if err := m.backend.Kill(ctx, job); err != nil {
+		logger.WithError(err).Error("jobs: kill failed")
+	}
+}
+
+func (m *Manager) backoff(attempt int) time.Duration {
+	delay := time.Duration(math.Pow(2, float64(attempt-1))) * m.config.BackoffBase
+	if delay <= 0 || delay > m.config.BackoffMax {
+		return m.config.BackoffMax
+	}
+	return delay
+}
@@ -0,0 +1,181 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testPayload struct {
+	Value int `json:"value"`
+}
+
+func newTestManager(backend Backend) *Manager {
+	return NewManager(backend, Config{
+		Workers:      2,
+		PollInterval: 5 * time.Millisecond,
+		MaxAttempts:  3,
+		BackoffBase:  time.Millisecond,
+		BackoffMax:   5 * time.Millisecond,
+	}, nil)
+}
+
+func TestManager_ProcessesTypedJob(t *testing.T) {
+	m := newTestManager(NewMemoryBackend())
+
+	got := make(chan int, 1)
+	Register[testPayload](m, "test", func(_ context.Context, p testPayload) error {
+		got <- p.Value
+		return nil
+	})
+
+	_, err := m.Enqueue(context.Background(), "test", testPayload{Value: 42})
+	assert.NoError(t, err)
+
+	m.Start()
+	defer m.Stop(context.Background())
+
+	select {
+	case v := <-got:
+		assert.Equal(t, 42, v)
+	case <-time.After(time.Second):
+		t.Fatal("job was not processed")
+	}
+}
+
+func TestManager_RetriesAndDeadLetter(t *testing.T) {
+	backend := NewMemoryBackend()
+	m := newTestManager(backend)
+
+	var calls atomic.Int32
+	m.Handle("fail", func(context.Context, json.RawMessage) error {
+		calls.Add(1)
+		return errors.New("boom")
+	})
+
+	_, err := m.Enqueue(context.Background(), "fail", nil)
+	assert.NoError(t, err)
+
+	m.Start()
+	assert.Eventually(t, func() bool {
+		dead, _ := backend.Dead(context.Background(), 10)
+		return len(dead) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.NoError(t, m.Stop(context.Background()))
+
+	dead, _ := backend.Dead(context.Background(), 10)
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, "boom", dead[0].LastError)
+}
+
+func TestManager_StopDoesNotWaitForStuckHandler(t *testing.T) {
+	m := newTestManager(NewMemoryBackend())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	m.Handle("stuck", func(context.Context, json.RawMessage) error {
+		close(started)
+		<-release
+		return nil
+	})
+
+	_, err := m.Enqueue(context.Background(), "stuck", nil)
+	assert.NoError(t, err)
+
+	m.Start()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- m.Stop(ctx)
+	}()
+
+	select {
+	case err = <-stopped:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("Stop waits for a handler which ignores ctx")
+	}
+}
+
+func TestManager_UniqueKey(t *testing.T) {
+	m := newTestManager(NewMemoryBackend())
+
+	_, err := m.Enqueue(context.Background(), "test", nil, WithUniqueKey("k"))
+	assert.NoError(t, err)
+
+	_, err = m.Enqueue(context.Background(), "test", nil, WithUniqueKey("k"))
+	assert.ErrorIs(t, err, ErrDuplicate)
+}
+
+func TestMemoryBackend_PopOrder(t *testing.T) {
+	m := newTestManager(NewMemoryBackend())
+	ctx := context.Background()
+
+	_, _ = m.Enqueue(ctx, "low", nil)
+	_, _ = m.Enqueue(ctx, "delayed", nil, WithDelay(time.Hour), WithPriority(100))
+	_, _ = m.Enqueue(ctx, "high", nil, WithPriority(10))
+
+	first, _ := m.Backend().Pop(ctx)
+	second, _ := m.Backend().Pop(ctx)
+	third, _ := m.Backend().Pop(ctx)
+
+	assert.Equal(t, "high", first.Name)
+	assert.Equal(t, "low", second.Name)
+	assert.Nil(t, third)
+}
+
+type leasingBackend struct {
+	*MemoryBackend
+	extended atomic.Int32
+}
+
+func (b *leasingBackend) Lease() time.Duration {
+	return 30 * time.Millisecond
+}
+
+func (b *leasingBackend) Extend(context.Context, *Job) error {
+	b.extended.Add(1)
+	return nil
+}
+
+func TestManager_ExtendsLeaseWhileRunning(t *testing.T) {
+	backend := &leasingBackend{MemoryBackend: NewMemoryBackend()}
+	m := newTestManager(backend)
+
+	done := make(chan struct{})
+	m.Handle("slow", func(context.Context, json.RawMessage) error {
+		time.Sleep(100 * time.Millisecond)
+		close(done)
+		return nil
+	})
+
+	_, err := m.Enqueue(context.Background(), "slow", nil)
+	assert.NoError(t, err)
+
+	m.Start()
+	defer m.Stop(context.Background())
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("job was not processed")
+	}
+
+	// Один job на 100ms при продлении каждые 10ms
+	assert.GreaterOrEqual(t, backend.extended.Load(), int32(5))
+	time.Sleep(20 * time.Millisecond)
+	extended := backend.extended.Load()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, extended, backend.extended.Load(), "heartbeat must stop with the handler")
+}
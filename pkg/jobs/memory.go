@@ -0,0 +1,110 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryBackend keeps jobs in process memory. It is intended for tests and local development.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	pending map[string]*Job
+	unique  map[string]string
+	dead    []*Job
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		pending: make(map[string]*Job),
+		unique:  make(map[string]string),
+	}
+}
+
+func (b *MemoryBackend) Push(_ context.Context, job *Job) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if job.UniqueKey != "" {
+		if _, ok := b.unique[job.UniqueKey]; ok {
+			return ErrDuplicate
+		}
+		b.unique[job.UniqueKey] = job.ID
+	}
+
+	b.pending[job.ID] = job
+	return nil
+}
+
+func (b *MemoryBackend) Pop(_ context.Context) (*Job, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	var next *Job
+	for _, job := range b.pending {
+		if job.RunAt.After(now) {
+			continue
+		}
+		if next == nil || job.Priority > next.Priority ||
+			(job.Priority == next.Priority && job.RunAt.Before(next.RunAt)) {
+			next = job
+		}
+	}
+
+	if next != nil {
+		delete(b.pending, next.ID)
+	}
+
+	return next, nil
+}
+
+func (b *MemoryBackend) Ack(_ context.Context, job *Job) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.releaseUnique(job)
+	return nil
+}
+
+func (b *MemoryBackend) Retry(_ context.Context, job *Job) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pending[job.ID] = job
+	return nil
+}
+
+func (b *MemoryBackend) Kill(_ context.Context, job *Job) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.releaseUnique(job)
+	b.dead = append(b.dead, job)
+	return nil
+}
+
+func (b *MemoryBackend) Dead(_ context.Context, limit int) ([]*Job, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	result := make([]*Job, 0, limit)
+	for i := len(b.dead) - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, b.dead[i])
+	}
+	return result, nil
+}
+
+// Len returns the number of pending jobs.
+func (b *MemoryBackend) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.pending)
+}
+
+func (b *MemoryBackend) releaseUnique(job *Job) {
+	if job.UniqueKey != "" && b.unique[job.UniqueKey] == job.ID {
+		delete(b.unique, job.UniqueKey)
+	}
+}
@@ -0,0 +1,29 @@
+package jobs
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	enqueuedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobs_enqueued_total",
+		Help: "Number of enqueued background jobs.",
+	}, []string{"job"})
+
+	processedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobs_processed_total",
+		Help: "Number of processed background jobs by result (success, retry, dead).",
+	}, []string{"job", "result"})
+
+	duration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "jobs_duration_seconds",
+		Help:    "Background job handler duration.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"job"})
+
+	inFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "jobs_in_flight",
+		Help: "Number of background jobs being processed right now.",
+	})
+)
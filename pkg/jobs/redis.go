@@ -0,0 +1,199 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// popScript returns expired leases to the schedule, promotes due jobs to the ready set
+// ordered by priority and run time, and leases the first ready job.
+var popScript = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[4], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, id in ipairs(expired) do
+	redis.call('ZREM', KEYS[4], id)
+	redis.call('ZADD', KEYS[1], ARGV[1], id)
+end
+
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'WITHSCORES', 'LIMIT', 0, 100)
+for i = 1, #due, 2 do
+	local id = due[i]
+	redis.call('ZREM', KEYS[1], id)
+	local data = redis.call('HGET', KEYS[3], id)
+	if data then
+		local priority = cjson.decode(data)['priority'] or 0
+		redis.call('ZADD', KEYS[2], tonumber(due[i + 1]) - priority * 1e13, id)
+	end
+end
+
+local next = redis.call('ZPOPMIN', KEYS[2])
+if #next == 0 then
+	return false
+end
+redis.call('ZADD', KEYS[4], ARGV[2], next[1])
+return redis.call('HGET', KEYS[3], next[1])
+`)
+
+// RedisBackend stores jobs in Redis so that they survive restarts and are shared between replicas.
+//
+// Keys used, all prefixed with the queue name:
+// :jobs (hash id -> job), :scheduled (zset by run time), :ready (zset by priority),
+// :processing (zset by lease deadline), :unique:<key> and :dead (list).
+type RedisBackend struct {
+	client *redis.Client
+	prefix string
+	lease  time.Duration
+	// uniqueMargin is how long a unique key outlives the run time of its job, in case the job
+	// is neither acked nor killed. The key is extended on every retry.
+	uniqueMargin time.Duration
+	deadLength   int64
+}
+
+var _ Leaser = (*RedisBackend)(nil)
+
+// NewRedisBackend creates a backend on top of client. Jobs that are not acked within lease
+// are considered lost (e.g. the worker pod was killed) and are returned to the queue.
+// Manager extends the lease while the handler runs, so lease does not limit the job duration.
+func NewRedisBackend(client *redis.Client, queue string, lease time.Duration) *RedisBackend {
+	if lease <= 0 {
+		lease = 5 * time.Minute
+	}
+	return &RedisBackend{
+		client:       client,
+		prefix:       queue,
+		lease:        lease,
+		uniqueMargin: 24 * time.Hour,
+		deadLength:   1000,
+	}
+}
+
+func (b *RedisBackend) Lease() time.Duration {
+	return b.lease
+}
+
+// Extend moves the lease deadline of a running job. A job whose lease already expired
+// was returned to the queue and is not leased again.
+func (b *RedisBackend) Extend(ctx context.Context, job *Job) error {
+	return b.client.ZAddXX(ctx, b.key("processing"), redis.Z{
+		Score:  float64(time.Now().Add(b.lease).UnixMilli()),
+		Member: job.ID,
+	}).Err()
+}
+
+func (b *RedisBackend) key(name string) string {
+	return b.prefix + ":" + name
+}
+
+func (b *RedisBackend) Push(ctx context.Context, job *Job) error {
+	if job.UniqueKey != "" {
+		ok, err := b.client.SetNX(ctx, b.key("unique:"+job.UniqueKey), job.ID, b.uniqueTTL(job)).Result()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrDuplicate
+		}
+	}
+
+	return b.schedule(ctx, job)
+}
+
+func (b *RedisBackend) Pop(ctx context.Context) (*Job, error) {
+	now := time.Now()
+	data, err := popScript.Run(ctx, b.client,
+		[]string{b.key("scheduled"), b.key("ready"), b.key("jobs"), b.key("processing")},
+		now.UnixMilli(), now.Add(b.lease).UnixMilli(),
+	).Text()
+
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var job Job
+	if err = json.Unmarshal([]byte(data), &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (b *RedisBackend) Ack(ctx context.Context, job *Job) error {
+	pipe := b.client.TxPipeline()
+	pipe.HDel(ctx, b.key("jobs"), job.ID)
+	pipe.ZRem(ctx, b.key("processing"), job.ID)
+	if job.UniqueKey != "" {
+		pipe.Del(ctx, b.key("unique:"+job.UniqueKey))
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (b *RedisBackend) Retry(ctx context.Context, job *Job) error {
+	return b.schedule(ctx, job)
+}
+
+func (b *RedisBackend) Kill(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	pipe := b.client.TxPipeline()
+	pipe.HDel(ctx, b.key("jobs"), job.ID)
+	pipe.ZRem(ctx, b.key("processing"), job.ID)
+	if job.UniqueKey != "" {
+		pipe.Del(ctx, b.key("unique:"+job.UniqueKey))
+	}
+	pipe.LPush(ctx, b.key("dead"), data)
+	pipe.LTrim(ctx, b.key("dead"), 0, b.deadLength-1)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (b *RedisBackend) Dead(ctx context.Context, limit int) ([]*Job, error) {
+	items, err := b.client.LRange(ctx, b.key("dead"), 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*Job, 0, len(items))
+	for _, item := range items {
+		var job Job
+		if err = json.Unmarshal([]byte(item), &job); err != nil {
+			continue
+		}
+		result = append(result, &job)
+	}
+	return result, nil
+}
+
+func (b *RedisBackend) schedule(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	pipe := b.client.TxPipeline()
+	pipe.HSet(ctx, b.key("jobs"), job.ID, data)
+	pipe.ZRem(ctx, b.key("processing"), job.ID)
+	pipe.ZAdd(ctx, b.key("scheduled"), redis.Z{
+		Score:  float64(job.RunAt.UnixMilli()),
+		Member: job.ID,
+	})
+	if job.UniqueKey != "" {
+		// Повтор может быть отложен дальше, чем живет ключ
+		pipe.Expire(ctx, b.key("unique:"+job.UniqueKey), b.uniqueTTL(job))
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// uniqueTTL keeps the unique key of a delayed job until it runs.
+func (b *RedisBackend) uniqueTTL(job *Job) time.Duration {
+	return time.Until(job.RunAt) + b.uniqueMargin
+}
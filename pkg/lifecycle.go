@@ -0,0 +1,106 @@
+package pkg
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/iteais/sdk/pkg/lifecycle"
+)
+
+type ShutdownConfig struct {
+	// DrainPeriod is the time between failing readiness and closing the port, so that load balancers
+	// stop sending requests. 5s by default, 0 in DEV.
+	DrainPeriod time.Duration
+	// ShutdownTimeout limits waiting for in-flight requests, 15s by default.
+	ShutdownTimeout time.Duration
+	// StopTimeout limits each OnStop hook: workers, telemetry flush and closing connections, 10s by default.
+	// Every hook has its own timeout, so slow workers do not leave Sentry and tracing without time to flush.
+	StopTimeout time.Duration
+}
+
+func (c ShutdownConfig) withDefaults() ShutdownConfig {
+	if c.DrainPeriod == 0 && strings.ToUpper(os.Getenv("ENVIRONMENT")) != "DEV" {
+		c.DrainPeriod = 5 * time.Second
+	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = 15 * time.Second
+	}
+	if c.StopTimeout == 0 {
+		c.StopTimeout = 10 * time.Second
+	}
+	return c
+}
+
+// OnStart adds a hook run before the server starts, e.g. warming a cache. An error aborts RunContext.
+func (a *Application) OnStart(name string, fn func(ctx context.Context) error) *Application {
+	a.Lifecycle.Append(lifecycle.Hook{Name: name, OnStart: fn})
+	return a
+}
+
+// OnStop adds a hook run after in-flight requests are finished. Hooks are stopped in reverse order,
+// so DB and Redis are still open in hooks of the service.
+func (a *Application) OnStop(name string, fn func(ctx context.Context) error) *Application {
+	a.Lifecycle.Append(lifecycle.Hook{Name: name, OnStop: fn})
+	return a
+}
+
+// registerLifecycle adds SDK components, they are stopped after hooks of the service.
+func (a *Application) registerLifecycle(stopTracing func(context.Context) error) {
+	a.OnStop("db", func(ctx context.Context) error {
+		return a.Db.Close()
+	})
+	if a.Redis != nil {
+		a.OnStop("redis", func(ctx context.Context) error {
+			return a.Redis.Close()
+		})
+	}
+	a.OnStop("tracing", stopTracing)
+	if hasSentry {
+		a.OnStop("sentry", func(ctx context.Context) error {
+			sentry.FlushWithContext(ctx)
+			return nil
+		})
+	}
+
+	a.Lifecycle.Append(lifecycle.Hook{
+		Name: "jobs",
+		OnStart: func(ctx context.Context) error {
+			a.Jobs.Start()
+			return nil
+		},
+		OnStop: a.Jobs.Stop,
+	})
+	a.Lifecycle.Append(lifecycle.Hook{
+		Name: "scheduler",
+		OnStart: func(ctx context.Context) error {
+			a.Scheduler.Start()
+			return nil
+		},
+		OnStop: a.Scheduler.Stop,
+	})
+
+	// Фоновые обновления не должны зависеть от ctx запуска: он отменяется в начале остановки
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	a.Lifecycle.Append(lifecycle.Hook{
+		Name: "background",
+		OnStart: func(ctx context.Context) error {
+			a.Stream.Start(backgroundCtx)
+			a.ApiAccounts.Listen(backgroundCtx)
+			a.Jwt.Start(backgroundCtx)
+			a.Policy.Start(backgroundCtx)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			stopBackground()
+			return nil
+		},
+	})
+}
+
+// stopLifecycle stops hooks, Lifecycle limits each of them by ShutdownConfig.StopTimeout.
+func (a *Application) stopLifecycle() error {
+	return a.Lifecycle.Stop(context.Background())
+}
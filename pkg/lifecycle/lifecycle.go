@@ -0,0 +1,100 @@
+// Package lifecycle starts and stops application components in order.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Hook is a component with optional start and stop functions.
+type Hook struct {
+	Name    string
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+	// StopTimeout limits OnStop of this hook, Config.StopTimeout by default.
+	StopTimeout time.Duration
+}
+
+type Config struct {
+	// StopTimeout limits OnStop of every hook separately, so a slow hook does not take the time
+	// of the hooks stopped after it. Zero means no limit besides ctx of Stop.
+	StopTimeout time.Duration
+}
+
+// Lifecycle starts hooks in the order they were appended and stops started hooks in reverse order,
+// so a component is stopped before the components it depends on.
+type Lifecycle struct {
+	config  Config
+	mu      sync.Mutex
+	hooks   []Hook
+	started int
+}
+
+func New() *Lifecycle {
+	return NewWithConfig(Config{})
+}
+
+func NewWithConfig(config Config) *Lifecycle {
+	return &Lifecycle{config: config}
+}
+
+func (l *Lifecycle) Append(hook Hook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, hook)
+}
+
+// Start runs OnStart of hooks which are not started yet. On error started hooks are stopped.
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for l.started < len(l.hooks) {
+		hook := l.hooks[l.started]
+		if hook.OnStart != nil {
+			if err := hook.OnStart(ctx); err != nil {
+				err = fmt.Errorf("lifecycle: start %s: %w", hook.Name, err)
+				return errors.Join(err, l.stop(ctx))
+			}
+		}
+		l.started++
+	}
+	return nil
+}
+
+// Stop runs OnStop of started hooks in reverse order. All hooks are stopped even if some fail.
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stop(ctx)
+}
+
+func (l *Lifecycle) stop(ctx context.Context) error {
+	var errs []error
+	for ; l.started > 0; l.started-- {
+		hook := l.hooks[l.started-1]
+		if hook.OnStop == nil {
+			continue
+		}
+		if err := l.stopHook(ctx, hook); err != nil {
+			errs = append(errs, fmt.Errorf("lifecycle: stop %s: %w", hook.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (l *Lifecycle) stopHook(ctx context.Context, hook Hook) error {
+	timeout := hook.StopTimeout
+	if timeout == 0 {
+		timeout = l.config.StopTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return hook.OnStop(ctx)
+}
@@ -0,0 +1,83 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycle(t *testing.T) {
+	var calls []string
+	hook := func(name string, startErr error, stopErr error) Hook {
+		return Hook{
+			Name: name,
+			OnStart: func(ctx context.Context) error {
+				calls = append(calls, "start "+name)
+				return startErr
+			},
+			OnStop: func(ctx context.Context) error {
+				calls = append(calls, "stop "+name)
+				return stopErr
+			},
+		}
+	}
+
+	l := New()
+	l.Append(hook("db", nil, nil))
+	l.Append(hook("jobs", nil, errors.New("timeout")))
+	l.Append(Hook{Name: "cache"})
+
+	assert.NoError(t, l.Start(context.Background()))
+	assert.EqualError(t, l.Stop(context.Background()), "lifecycle: stop jobs: timeout")
+	assert.Equal(t, []string{"start db", "start jobs", "stop jobs", "stop db"}, calls)
+
+	// Остановленные хуки повторно не останавливаются
+	assert.NoError(t, l.Stop(context.Background()))
+}
+
+func TestLifecycle_StartError(t *testing.T) {
+	var stopped []string
+	l := New()
+	l.Append(Hook{Name: "db", OnStop: func(ctx context.Context) error {
+		stopped = append(stopped, "db")
+		return nil
+	}})
+	l.Append(Hook{Name: "broker", OnStart: func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}, OnStop: func(ctx context.Context) error {
+		stopped = append(stopped, "broker")
+		return nil
+	}})
+
+	assert.EqualError(t, l.Start(context.Background()), "lifecycle: start broker: connection refused")
+	assert.Equal(t, []string{"db"}, stopped)
+}
+
+func TestLifecycle_StopTimeoutPerHook(t *testing.T) {
+	l := NewWithConfig(Config{StopTimeout: 50 * time.Millisecond})
+
+	var flushErr error
+	l.Append(Hook{Name: "sentry", OnStop: func(ctx context.Context) error {
+		flushErr = ctx.Err()
+		return nil
+	}})
+	l.Append(Hook{Name: "jobs", OnStop: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	l.Append(Hook{Name: "fast", StopTimeout: time.Millisecond, OnStop: func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}})
+
+	assert.NoError(t, l.Start(context.Background()))
+	err := l.Stop(context.Background())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualError(t, err, "lifecycle: stop jobs: context deadline exceeded")
+
+	// Зависший jobs не забрал время у хука, остановленного после него
+	assert.NoError(t, flushErr)
+}
@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/health"
+	"github.com/iteais/sdk/pkg/lifecycle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplication_RunContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	baseUrl := "http://" + listener.Addr().String()
+
+	var mu sync.Mutex
+	var calls []string
+	record := func(call string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, call)
+	}
+
+	a := &Application{
+		Router:    gin.New(),
+		Health:    health.NewRegistry(),
+		Lifecycle: lifecycle.New(),
+		shutdown:  ShutdownConfig{DrainPeriod: 200 * time.Millisecond, ShutdownTimeout: time.Second, StopTimeout: time.Second},
+		listener:  listener,
+	}
+	a.OnStop("db", func(ctx context.Context) error {
+		record("stop db")
+		return nil
+	})
+	a.OnStart("cache", func(ctx context.Context) error {
+		record("start cache")
+		return nil
+	}).OnStop("cache", func(ctx context.Context) error {
+		record("stop cache")
+		return nil
+	})
+
+	requestStarted := make(chan struct{})
+	a.AppendGetEndpoint("/slow", func(c *gin.Context) {
+		close(requestStarted)
+		time.Sleep(300 * time.Millisecond)
+		record("request done")
+		c.Status(http.StatusOK)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- a.RunContext(ctx)
+	}()
+
+	ready := func() int {
+		resp, err := http.Get(baseUrl + HealthReadyEndpoint)
+		if err != nil {
+			return 0
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Eventually(t, func() bool {
+		return ready() == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	slowStatus := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(baseUrl + "/slow")
+		if err != nil {
+			slowStatus <- 0
+			return
+		}
+		_ = resp.Body.Close()
+		slowStatus <- resp.StatusCode
+	}()
+	<-requestStarted
+
+	cancel()
+
+	// Во время DrainPeriod сервер отвечает, но уже не готов
+	require.Eventually(t, func() bool {
+		return ready() == http.StatusServiceUnavailable
+	}, 150*time.Millisecond, 10*time.Millisecond)
+
+	assert.NoError(t, <-runErr)
+	assert.Equal(t, http.StatusOK, <-slowStatus)
+	assert.Equal(t, []string{"start cache", "request done", "stop cache", "stop db"}, calls)
+}
+
+func TestApplication_RunContext_StartError(t *testing.T) {
+	var stopped bool
+	a := &Application{
+		Router:    gin.New(),
+		Health:    health.NewRegistry(),
+		Lifecycle: lifecycle.New(),
+		shutdown:  ShutdownConfig{}.withDefaults(),
+	}
+	a.OnStop("db", func(ctx context.Context) error {
+		stopped = true
+		return nil
+	})
+	a.OnStart("broker", func(ctx context.Context) error {
+		return assert.AnError
+	})
+
+	assert.ErrorIs(t, a.RunContext(context.Background()), assert.AnError)
+	assert.True(t, stopped)
+}
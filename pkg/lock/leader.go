@@ -0,0 +1,110 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LeaderCallbacks are invoked by LeaderElector on leadership changes.
+type LeaderCallbacks struct {
+	// OnElected is called in its own goroutine when this replica becomes the leader.
+	// ctx is cancelled as soon as leadership is lost or the elector stops.
+	OnElected func(ctx context.Context, token int64)
+	// OnRevoked is called after leadership is lost and OnElected has returned.
+	OnRevoked func()
+}
+
+// LeaderElector keeps trying to hold a lock and reports when this replica gains or loses it.
+//
+//	elector := lock.NewLeaderElector(pkg.App.Locker, "events-consumer", 15*time.Second, lock.LeaderCallbacks{
+//		OnElected: func(ctx context.Context, _ int64) { consume(ctx) },
+//	})
+//	go elector.Run(ctx)
+type LeaderElector struct {
+	locker    Locker
+	key       string
+	ttl       time.Duration
+	callbacks LeaderCallbacks
+	leader    atomic.Bool
+	logger    logrus.FieldLogger
+}
+
+func NewLeaderElector(locker Locker, key string, ttl time.Duration, callbacks LeaderCallbacks) *LeaderElector {
+	return &LeaderElector{
+		locker:    locker,
+		key:       key,
+		ttl:       ttl,
+		callbacks: callbacks,
+		logger:    logrus.StandardLogger().WithField("leader", key),
+	}
+}
+
+// IsLeader reports whether this replica currently holds leadership.
+func (e *LeaderElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run blocks until ctx is done, campaigning for leadership whenever it is not held.
+func (e *LeaderElector) Run(ctx context.Context) error {
+	for {
+		l, err := e.locker.Acquire(ctx, e.key, e.ttl)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			e.logger.WithError(err).Warn("lock: leader election failed")
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(e.ttl / 3):
+			}
+			continue
+		}
+
+		e.lead(ctx, l)
+
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+func (e *LeaderElector) lead(ctx context.Context, l *Lock) {
+	e.leader.Store(true)
+	e.logger.Infof("lock: became leader with token %d", l.Token)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		if e.callbacks.OnElected != nil {
+			e.callbacks.OnElected(leaderCtx, l.Token)
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+	case <-l.Lost():
+		e.logger.Warn("lock: leadership lost")
+	}
+
+	cancel()
+	<-finished
+	e.leader.Store(false)
+
+	releaseCtx, releaseCancel := context.WithTimeout(context.Background(), e.ttl)
+	if err := l.Release(releaseCtx); err != nil && !errors.Is(err, ErrNotHeld) {
+		e.logger.WithError(err).Warn("lock: release failed")
+	}
+	releaseCancel()
+
+	if e.callbacks.OnRevoked != nil {
+		e.callbacks.OnRevoked()
+	}
+}
@@ -0,0 +1,129 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotAcquired is returned by TryAcquire when the lock is held by someone else.
+	ErrNotAcquired = errors.New("lock: not acquired")
+	// ErrNotHeld is returned by Release when the lock expired or was taken over.
+	ErrNotHeld = errors.New("lock: not held")
+)
+
+// RetryInterval is how often Acquire retries a busy lock.
+var RetryInterval = 100 * time.Millisecond
+
+// Locker creates distributed locks.
+type Locker interface {
+	// TryAcquire takes the lock once and returns ErrNotAcquired if it is busy.
+	TryAcquire(ctx context.Context, key string, ttl time.Duration) (*Lock, error)
+	// Acquire waits until the lock is taken or ctx is done.
+	Acquire(ctx context.Context, key string, ttl time.Duration) (*Lock, error)
+}
+
+// Lock is a held lock. It is renewed in the background every ttl/3 until Release is called.
+// If renewal fails the lock is considered lost and Lost() is closed.
+type Lock struct {
+	Key string
+	// Token is a fencing token which strictly increases every time the key is acquired.
+	// Pass it to the protected resource to reject writes from a stale holder.
+	Token int64
+
+	renew   func(ctx context.Context) (bool, error)
+	release func(ctx context.Context) error
+
+	lost     chan struct{}
+	lostOnce sync.Once
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newLock(key string, token int64, ttl time.Duration, renew func(context.Context) (bool, error), release func(context.Context) error) *Lock {
+	l := &Lock{
+		Key:     key,
+		Token:   token,
+		renew:   renew,
+		release: release,
+		lost:    make(chan struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go l.keepAlive(ttl)
+
+	return l
+}
+
+// Lost is closed when the lock could not be renewed.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Release stops renewal and frees the lock.
+func (l *Lock) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+	})
+	<-l.done
+
+	select {
+	case <-l.lost:
+		// Still free resources held by the backend, e.g. the Postgres connection.
+		_ = l.release(ctx)
+		return ErrNotHeld
+	default:
+	}
+
+	return l.release(ctx)
+}
+
+func (l *Lock) keepAlive(ttl time.Duration) {
+	defer close(l.done)
+
+	interval := ttl / 3
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		ok, err := l.renew(ctx)
+		cancel()
+
+		if err != nil || !ok {
+			l.lostOnce.Do(func() {
+				close(l.lost)
+			})
+			return
+		}
+	}
+}
+
+func acquire(ctx context.Context, locker Locker, key string, ttl time.Duration) (*Lock, error) {
+	for {
+		l, err := locker.TryAcquire(ctx, key, ttl)
+		if !errors.Is(err, ErrNotAcquired) {
+			return l, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(RetryInterval):
+		}
+	}
+}
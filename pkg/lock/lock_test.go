@@ -0,0 +1,98 @@
+package lock
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryLocker_TryAcquire(t *testing.T) {
+	locker := NewMemoryLocker()
+	ctx := context.Background()
+
+	first, err := locker.TryAcquire(ctx, "key", time.Second)
+	assert.NoError(t, err)
+
+	_, err = locker.TryAcquire(ctx, "key", time.Second)
+	assert.ErrorIs(t, err, ErrNotAcquired)
+
+	assert.NoError(t, first.Release(ctx))
+
+	second, err := locker.TryAcquire(ctx, "key", time.Second)
+	assert.NoError(t, err)
+	assert.Greater(t, second.Token, first.Token)
+	assert.NoError(t, second.Release(ctx))
+}
+
+func TestMemoryLocker_Renewal(t *testing.T) {
+	locker := NewMemoryLocker()
+	ctx := context.Background()
+
+	l, err := locker.TryAcquire(ctx, "key", 60*time.Millisecond)
+	assert.NoError(t, err)
+
+	time.Sleep(150 * time.Millisecond)
+
+	_, err = locker.TryAcquire(ctx, "key", time.Second)
+	assert.ErrorIs(t, err, ErrNotAcquired, "lock must be renewed while held")
+	assert.NoError(t, l.Release(ctx))
+}
+
+func TestMemoryLocker_Acquire(t *testing.T) {
+	locker := NewMemoryLocker()
+
+	l, _ := locker.TryAcquire(context.Background(), "key", time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := locker.Acquire(ctx, "key", time.Second)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = l.Release(context.Background())
+	}()
+
+	l, err = locker.Acquire(context.Background(), "key", time.Second)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Release(context.Background()))
+}
+
+func TestLeaderElector(t *testing.T) {
+	locker := NewMemoryLocker()
+
+	var elected, revoked atomic.Int32
+	callbacks := LeaderCallbacks{
+		OnElected: func(ctx context.Context, _ int64) {
+			elected.Add(1)
+			<-ctx.Done()
+		},
+		OnRevoked: func() {
+			revoked.Add(1)
+		},
+	}
+
+	first := NewLeaderElector(locker, "leader", 300*time.Millisecond, callbacks)
+	second := NewLeaderElector(locker, "leader", 300*time.Millisecond, callbacks)
+
+	firstCtx, stopFirst := context.WithCancel(context.Background())
+	secondCtx, stopSecond := context.WithCancel(context.Background())
+	defer stopSecond()
+
+	go first.Run(firstCtx)
+	assert.Eventually(t, first.IsLeader, time.Second, 10*time.Millisecond)
+
+	go second.Run(secondCtx)
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, second.IsLeader())
+
+	stopFirst()
+	assert.Eventually(t, second.IsLeader, time.Second, 10*time.Millisecond)
+	assert.False(t, first.IsLeader())
+	assert.Eventually(t, func() bool {
+		return elected.Load() == 2 && revoked.Load() == 1
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,66 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryLocker keeps locks in process memory. It is intended for tests and single replica setups.
+type MemoryLocker struct {
+	mu     sync.Mutex
+	owners map[string]*memoryEntry
+	fence  map[string]int64
+}
+
+type memoryEntry struct {
+	token   int64
+	expires time.Time
+}
+
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{
+		owners: make(map[string]*memoryEntry),
+		fence:  make(map[string]int64),
+	}
+}
+
+func (m *MemoryLocker) TryAcquire(_ context.Context, key string, ttl time.Duration) (*Lock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.owners[key]; ok && time.Now().Before(entry.expires) {
+		return nil, ErrNotAcquired
+	}
+
+	m.fence[key]++
+	entry := &memoryEntry{token: m.fence[key], expires: time.Now().Add(ttl)}
+	m.owners[key] = entry
+
+	renew := func(context.Context) (bool, error) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if m.owners[key] != entry {
+			return false, nil
+		}
+		entry.expires = time.Now().Add(ttl)
+		return true, nil
+	}
+	release := func(context.Context) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if m.owners[key] != entry {
+			return ErrNotHeld
+		}
+		delete(m.owners, key)
+		return nil
+	}
+
+	return newLock(key, entry.token, ttl, renew, release), nil
+}
+
+func (m *MemoryLocker) Acquire(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	return acquire(ctx, m, key, ttl)
+}
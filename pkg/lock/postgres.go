@@ -0,0 +1,90 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// pgKeyPrefix separates keys of PgLocker from other advisory locks of the database.
+const pgKeyPrefix = "sdk_lock:"
+
+// PgLocker uses session level Postgres advisory locks. The lock lives as long as the
+// dedicated connection, renewal only checks that the connection is alive, so ttl only
+// sets the check interval. Fencing tokens come from the sdk_lock_fence sequence.
+type PgLocker struct {
+	db     *bun.DB
+	initMu sync.Mutex
+	inited bool
+}
+
+func NewPgLocker(db *bun.DB) *PgLocker {
+	return &PgLocker{db: db}
+}
+
+// init creates the fence sequence, a failed attempt is retried on the next call.
+func (p *PgLocker) init(ctx context.Context) error {
+	p.initMu.Lock()
+	defer p.initMu.Unlock()
+	if p.inited {
+		return nil
+	}
+
+	// Отмена первого вызова не должна прерывать DDL
+	if _, err := p.db.ExecContext(context.WithoutCancel(ctx), "CREATE SEQUENCE IF NOT EXISTS sdk_lock_fence"); err != nil {
+		return err
+	}
+	p.inited = true
+	return nil
+}
+
+func (p *PgLocker) TryAcquire(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	if err := p.init(ctx); err != nil {
+		return nil, err
+	}
+
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ok bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext(?))", pgKeyPrefix+key).Scan(&ok)
+	if err != nil || !ok {
+		_ = conn.Close()
+		if err == nil {
+			err = ErrNotAcquired
+		}
+		return nil, err
+	}
+
+	var token int64
+	if err = conn.QueryRowContext(ctx, "SELECT nextval('sdk_lock_fence')").Scan(&token); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	renew := func(ctx context.Context) (bool, error) {
+		return true, conn.PingContext(ctx)
+	}
+	release := func(ctx context.Context) error {
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		var ok bool
+		err := conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock(hashtext(?))", pgKeyPrefix+key).Scan(&ok)
+		if err == nil && !ok {
+			return ErrNotHeld
+		}
+		return err
+	}
+
+	return newLock(key, token, ttl, renew, release), nil
+}
+
+func (p *PgLocker) Acquire(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	return acquire(ctx, p, key, ttl)
+}
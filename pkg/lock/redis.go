@@ -0,0 +1,70 @@
+package lock
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+var acquireScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0
+`)
+
+var renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisLocker keeps locks in Redis keys with an expiry. The fencing counter is stored in <key>:fence.
+type RedisLocker struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisLocker(client *redis.Client, prefix string) *RedisLocker {
+	return &RedisLocker{client: client, prefix: prefix}
+}
+
+func (r *RedisLocker) TryAcquire(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	redisKey := r.prefix + ":lock:" + key
+	owner := uuid.New().String()
+
+	token, err := acquireScript.Run(ctx, r.client, []string{redisKey, redisKey + ":fence"}, owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return nil, err
+	}
+	if token == 0 {
+		return nil, ErrNotAcquired
+	}
+
+	renew := func(ctx context.Context) (bool, error) {
+		return renewScript.Run(ctx, r.client, []string{redisKey}, owner, ttl.Milliseconds()).Bool()
+	}
+	release := func(ctx context.Context) error {
+		ok, err := releaseScript.Run(ctx, r.client, []string{redisKey}, owner).Bool()
+		if err == nil && !ok {
+			return ErrNotHeld
+		}
+		return err
+	}
+
+	return newLock(key, token, ttl, renew, release), nil
+}
+
+func (r *RedisLocker) Acquire(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	return acquire(ctx, r, key, ttl)
+}
@@ -1,13 +1,21 @@
 package pkg
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"math"
+	"math/rand/v2"
 	"net/http"
 	"os"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/logging"
+	"github.com/iteais/sdk/pkg/models"
+	"github.com/iteais/sdk/pkg/redact"
 	"github.com/sirupsen/logrus"
 )
 
@@ -22,26 +30,119 @@ type AppLogger struct {
 
 var timeFormat = "02/Jan/2006:15:04:05 -0700"
 
+const (
+	defaultMaxLoggedBody   = 4 << 10
+	defaultSlowHttpRequest = time.Second
+)
+
+// HttpLogRule selects requests by route and status and sets the share of them which is logged.
+type HttpLogRule struct {
+	// Route is a path.Match pattern of c.FullPath(), e.g. "/admin/*", or of the path of unmatched requests.
+	// Empty Route matches all requests.
+	Route string
+	// MinStatus and MaxStatus limit matched statuses, 0 means no limit.
+	MinStatus int
+	MaxStatus int
+	// SampleRate is the logged share of matched requests: 0 skips them, 1 logs all of them.
+	SampleRate float64
+}
+
+// DefaultHttpLogRules skip successful probe and metrics requests.
+var DefaultHttpLogRules = []HttpLogRule{
+	{Route: HealthEndpoint, MaxStatus: 499},
+	{Route: HealthEndpoint + "/*", MaxStatus: 499},
+	{Route: ReadyEndpoint, MaxStatus: 499},
+	{Route: MetricsEndpoint, MaxStatus: 499},
+}
+
+func (r HttpLogRule) match(route string, status int) bool {
+	if r.MinStatus != 0 && status < r.MinStatus {
+		return false
+	}
+	if r.MaxStatus != 0 && status > r.MaxStatus {
+		return false
+	}
+	if r.Route == "" {
+		return true
+	}
+	matched, _ := path.Match(r.Route, route)
+	return matched
+}
+
+type HttpLoggerConfig struct {
+	// NotLogged are paths which are never logged.
+	NotLogged []string
+	// Rules are checked in order, the first matching rule decides whether the request is logged.
+	// Requests without a matching rule are logged. DefaultHttpLogRules are used when Rules is nil.
+	// Errors (5xx or c.Errors) and requests slower than SlowThreshold are logged regardless of Rules.
+	Rules []HttpLogRule
+	// SlowThreshold defaults to 1s, slow requests are logged at warn level.
+	SlowThreshold time.Duration
+	// BodyRoutes are route templates (c.FullPath()) whose request and response bodies are logged, "*" for all routes.
+	BodyRoutes []string
+	// MaxBodySize caps logged bodies, 4KB by default.
+	MaxBodySize int
+	// BodyContentTypes are logged content types, JSON, forms and text by default.
+	BodyContentTypes []string
+	// Redactor masks headers, bodies and the referer, redact.Default by default.
+	Redactor *redact.Redactor
+}
+
 // HttpLogger is the logrus logger handler
 func HttpLogger(logger logrus.FieldLogger, notLogged ...string) gin.HandlerFunc {
+	return HttpLoggerWithConfig(logger, HttpLoggerConfig{NotLogged: notLogged})
+}
+
+// HttpLoggerWithConfig logs requests like HttpLogger, for BodyRoutes redacted headers and bodies are added.
+func HttpLoggerWithConfig(logger logrus.FieldLogger, config HttpLoggerConfig) gin.HandlerFunc {
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = "unknow"
 	}
 
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = defaultMaxLoggedBody
+	}
+	if config.BodyContentTypes == nil {
+		config.BodyContentTypes = []string{"json", "x-www-form-urlencoded", "text/"}
+	}
+	if config.Redactor == nil {
+		config.Redactor = redact.Default
+	}
+	if config.Rules == nil {
+		config.Rules = DefaultHttpLogRules
+	}
+	if config.SlowThreshold == 0 {
+		config.SlowThreshold = defaultSlowHttpRequest
+	}
+
 	var skip map[string]struct{}
 
-	if length := len(notLogged); length > 0 {
+	if length := len(config.NotLogged); length > 0 {
 		skip = make(map[string]struct{}, length)
 
-		for _, p := range notLogged {
+		for _, p := range config.NotLogged {
 			skip[p] = struct{}{}
 		}
 	}
 
+	bodyRoutes := make(map[string]struct{}, len(config.BodyRoutes))
+	for _, route := range config.BodyRoutes {
+		bodyRoutes[route] = struct{}{}
+	}
+
 	return func(c *gin.Context) {
 		// other handler can change c.Path so:
 		path := c.Request.URL.Path
+
+		var requestBody []byte
+		var responseBody *bodyLogWriter
+		if logBody(bodyRoutes, c.FullPath()) {
+			requestBody = readLoggedBody(c.Request, config.MaxBodySize)
+			responseBody = &bodyLogWriter{ResponseWriter: c.Writer, limit: config.MaxBodySize}
+			c.Writer = responseBody
+		}
+
 		start := time.Now()
 		c.Next()
 		stop := time.Since(start)
@@ -49,7 +150,7 @@ func HttpLogger(logger logrus.FieldLogger, notLogged ...string) gin.HandlerFunc
 		statusCode := c.Writer.Status()
 		clientIP := c.ClientIP()
 		clientUserAgent := c.Request.UserAgent()
-		referer := c.Request.Referer()
+		referer := config.Redactor.String(c.Request.Referer())
 		dataLength := c.Writer.Size()
 		if dataLength < 0 {
 			dataLength = 0
@@ -59,6 +160,12 @@ func HttpLogger(logger logrus.FieldLogger, notLogged ...string) gin.HandlerFunc
 			return
 		}
 
+		slow := stop >= config.SlowThreshold
+		failed := statusCode >= http.StatusInternalServerError || len(c.Errors) > 0
+		if !slow && !failed && !sampled(config.Rules, c.FullPath(), path, statusCode) {
+			return
+		}
+
 		entry := logger.WithFields(logrus.Fields{
 			"hostname":   hostname,
 			"statusCode": statusCode,
@@ -72,13 +179,34 @@ func HttpLogger(logger logrus.FieldLogger, notLogged ...string) gin.HandlerFunc
 			"traceId":    c.GetString(TraceIdContextKey),
 		})
 
+		if account, ok := c.Get(ApiAccountContextKey); ok {
+			entry = entry.WithField("apiAccountId", account.(models.ApiAccount).ID)
+		}
+
+		if network := c.GetString(HmacBypassContextKey); network != "" {
+			entry = entry.WithField("hmacBypass", network)
+		}
+
+		if responseBody != nil {
+			entry = entry.WithFields(logrus.Fields{
+				"requestHeaders": config.Redactor.Headers(c.Request.Header),
+				"query":          config.Redactor.Query(c.Request.URL.Query()),
+			})
+			if body := loggedBody(config, requestBody, c.ContentType()); body != "" {
+				entry = entry.WithField("requestBody", body)
+			}
+			if body := loggedBody(config, responseBody.body.Bytes(), c.Writer.Header().Get("Content-Type")); body != "" {
+				entry = entry.WithField("responseBody", body)
+			}
+		}
+
 		if len(c.Errors) > 0 {
-			entry.Error(c.Errors.ByType(gin.ErrorTypePrivate).String())
+			entry.Error(config.Redactor.String(c.Errors.ByType(gin.ErrorTypePrivate).String()))
 		} else {
 			msg := fmt.Sprintf("%s - %s [%s] \"%s %s\" %d %d \"%s\" \"%s\" (%dms)", clientIP, hostname, time.Now().Format(timeFormat), c.Request.Method, path, statusCode, dataLength, referer, clientUserAgent, latency)
 			if statusCode >= http.StatusInternalServerError {
 				entry.Error(msg)
-			} else if statusCode >= http.StatusBadRequest {
+			} else if statusCode >= http.StatusBadRequest || slow {
 				entry.Warn(msg)
 			} else {
 				entry.Info(msg)
@@ -86,3 +214,117 @@ func HttpLogger(logger logrus.FieldLogger, notLogged ...string) gin.HandlerFunc
 		}
 	}
 }
+
+func sampled(rules []HttpLogRule, route string, path string, status int) bool {
+	if route == "" {
+		route = path
+	}
+	for _, rule := range rules {
+		if !rule.match(route, status) {
+			continue
+		}
+		return rule.SampleRate >= 1 || (rule.SampleRate > 0 && rand.Float64() < rule.SampleRate)
+	}
+	return true
+}
+
+func logBody(routes map[string]struct{}, route string) bool {
+	if _, ok := routes["*"]; ok {
+		return true
+	}
+	_, ok := routes[route]
+	return ok && route != ""
+}
+
+// readLoggedBody reads up to limit+1 bytes, the handler still gets the whole body.
+func readLoggedBody(r *http.Request, limit int) []byte {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	return body
+}
+
+func loggedBody(config HttpLoggerConfig, body []byte, contentType string) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	logged := false
+	for _, allowed := range config.BodyContentTypes {
+		if strings.Contains(contentType, allowed) {
+			logged = true
+			break
+		}
+	}
+	if !logged {
+		return "(" + contentType + ")"
+	}
+
+	if len(body) > config.MaxBodySize {
+		// Обрезанный JSON не разобрать, маскируются только regex
+		return config.Redactor.String(string(body[:config.MaxBodySize])) + "...(truncated)"
+	}
+	return config.Redactor.Body(body, contentType)
+}
+
+// bodyLogWriter keeps the first limit+1 bytes of the response.
+type bodyLogWriter struct {
+	gin.ResponseWriter
+	body  bytes.Buffer
+	limit int
+}
+
+func (w *bodyLogWriter) Write(b []byte) (int, error) {
+	w.keep(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyLogWriter) WriteString(s string) (int, error) {
+	w.keep([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *bodyLogWriter) keep(b []byte) {
+	if room := w.limit + 1 - w.body.Len(); room > 0 {
+		w.body.Write(b[:min(len(b), room)])
+	}
+}
+
+type logLevelRequest struct {
+	Level string `json:"level" binding:"required" example:"debug"`
+}
+
+// AppendLogLevel serves the level of App.Logger and App.Log on GET and changes it without restart
+// on POST {"level": "debug"}. Only this replica is changed. The endpoint is protected by HmacMiddleware,
+// changing the level also requires LogLevelPermission.
+func (a *Application) AppendLogLevel() *Application {
+	a.AppendGetEndpoint(LogLevelEndpoint, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"data": gin.H{"level": logging.Level.Level().String()}})
+	})
+	a.AppendPostEndpoint(LogLevelEndpoint, PermissionMiddleware(LogLevelPermission), func(c *gin.Context) {
+		var request logLevelRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		level, err := logging.ParseLevel(request.Level)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		previous := logging.Level.Level()
+		logging.Level.Set(level)
+		a.Logger.WarnContext(c, "log level changed", "from", previous.String(), "to", level.String())
+
+		c.JSON(http.StatusOK, gin.H{"data": gin.H{"level": level.String()}})
+	})
+	return a
+}
@@ -0,0 +1,175 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/auth"
+	"github.com/iteais/sdk/pkg/logging"
+	"github.com/iteais/sdk/pkg/models"
+	"github.com/iteais/sdk/pkg/redact"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendLogLevel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	previousLevel := logging.Level.Level()
+	defer logging.Level.Set(previousLevel)
+	logging.Level.Set(slog.LevelInfo)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		setPrincipal(c, &auth.Principal{ApiAccount: &models.ApiAccount{Role: c.GetHeader("Role")}})
+	})
+
+	var buf bytes.Buffer
+	previous := App
+	App = &Application{
+		Router: router,
+		Logger: logging.New(logging.Config{Output: &buf}),
+		Policy: auth.NewPolicy(auth.PolicyConfig{Roles: map[string][]string{"ops": {LogLevelPermission}}}),
+	}
+	defer func() {
+		App = previous
+	}()
+	App.AppendLogLevel()
+
+	call := func(method string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, LogLevelEndpoint, bytes.NewBufferString(body))
+		r.Header.Set("Role", "ops")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := call(http.MethodGet, "")
+	assert.JSONEq(t, `{"data":{"level":"INFO"}}`, w.Body.String())
+
+	w = call(http.MethodPost, `{"level":"debug"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, slog.LevelDebug, logging.Level.Level())
+	assert.Contains(t, buf.String(), "log level changed")
+
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, `{"level":"verbose"}`).Code)
+	assert.Equal(t, slog.LevelDebug, logging.Level.Level())
+
+	// Другие API-ключи уровень не меняют
+	r := httptest.NewRequest(http.MethodPost, LogLevelEndpoint, bytes.NewBufferString(`{"level":"info"}`))
+	r.Header.Set("Role", "partner")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, slog.LevelDebug, logging.Level.Level())
+}
+
+func TestHttpLoggerWithConfig_Body(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	logger, hook := test.NewNullLogger()
+	router := gin.New()
+	router.Use(HttpLoggerWithConfig(logger, HttpLoggerConfig{BodyRoutes: []string{"/login", "/upload"}, MaxBodySize: 256}))
+	router.POST("/login", func(c *gin.Context) {
+		var request map[string]string
+		assert.NoError(t, c.ShouldBindJSON(&request))
+		c.JSON(http.StatusOK, gin.H{"data": gin.H{"email": request["email"], "access_token": "eyJhbGciOiJIUzI1NiJ9.e30.sig"}})
+	})
+	router.POST("/upload", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, "%d", len(body))
+	})
+	router.GET("/events", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"data": []string{}})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/login?email=john@example.com", strings.NewReader(`{"email":"john@example.com","password":"secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(auth.UserJwtHttpHeader, "token")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Обработчик получает тело целиком
+	assert.Contains(t, w.Body.String(), "john@example.com")
+
+	entry := hook.LastEntry()
+	assert.JSONEq(t, `{"email":"[REDACTED]","password":"[REDACTED]"}`, entry.Data["requestBody"].(string))
+	assert.JSONEq(t, `{"data":{"email":"[REDACTED]","access_token":"[REDACTED]"}}`, entry.Data["responseBody"].(string))
+	assert.Equal(t, redact.Mask, entry.Data["requestHeaders"].(map[string]string)[auth.UserJwtHttpHeader])
+	assert.Equal(t, "email=%5BREDACTED%5D", entry.Data["query"])
+
+	// В лог попадает только начало тела
+	req = httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("a", 300)))
+	req.Header.Set("Content-Type", "text/plain")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "300", w.Body.String())
+	assert.Equal(t, strings.Repeat("a", 256)+"...(truncated)", hook.LastEntry().Data["requestBody"])
+
+	// Тела других маршрутов не пишутся
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/events", nil))
+	assert.NotContains(t, hook.LastEntry().Data, "responseBody")
+}
+
+func TestLoggedBody_Truncated(t *testing.T) {
+	config := HttpLoggerConfig{MaxBodySize: 10, BodyContentTypes: []string{"json"}, Redactor: redact.Default}
+
+	assert.Equal(t, `{"a":"1234...(truncated)`, loggedBody(config, []byte(`{"a":"123456789"}`), "application/json"))
+	assert.Equal(t, "(image/png)", loggedBody(config, []byte("png"), "image/png"))
+}
+
+func TestHttpLoggerWithConfig_Rules(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	logger, hook := test.NewNullLogger()
+	router := gin.New()
+	router.Use(HttpLoggerWithConfig(logger, HttpLoggerConfig{
+		Rules: append([]HttpLogRule{
+			{Route: "/events/*", MaxStatus: 399, SampleRate: 0},
+			{Route: "/admin/*", SampleRate: 1},
+		}, DefaultHttpLogRules...),
+		SlowThreshold: 50 * time.Millisecond,
+	}))
+	router.GET(HealthEndpoint, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET(ReadyEndpoint, func(c *gin.Context) {
+		c.Status(http.StatusServiceUnavailable)
+	})
+	router.GET("/events/:id", func(c *gin.Context) {
+		switch c.Param("id") {
+		case "slow":
+			time.Sleep(60 * time.Millisecond)
+		case "missing":
+			c.Status(http.StatusNotFound)
+			return
+		case "broken":
+			_ = c.Error(errors.New("db is down"))
+		}
+		c.Status(http.StatusOK)
+	})
+
+	logged := func(path string) bool {
+		hook.Reset()
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		return len(hook.AllEntries()) > 0
+	}
+
+	assert.False(t, logged(HealthEndpoint))
+	assert.True(t, logged(ReadyEndpoint), "failed probes are logged")
+	assert.False(t, logged("/events/1"))
+	assert.True(t, logged("/events/missing"))
+	assert.True(t, logged("/events/broken"), "errors are always logged")
+	assert.True(t, logged("/events/slow"), "slow requests are always logged")
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	assert.True(t, logged("/unknown"))
+}
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/iteais/sdk/pkg/auth"
+)
+
+// ContextHandler adds attributes from ContextWith and the request principal (userId, apiKey).
+type ContextHandler struct {
+	next slog.Handler
+}
+
+var _ slog.Handler = ContextHandler{}
+
+func NewContextHandler(next slog.Handler) ContextHandler {
+	return ContextHandler{next: next}
+}
+
+func (h ContextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h ContextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx == nil {
+		return h.next.Handle(ctx, record)
+	}
+
+	record.AddAttrs(attrsFromContext(ctx)...)
+
+	if principal, ok := auth.PrincipalFromContext(ctx); ok {
+		if principal.User != nil {
+			record.AddAttrs(slog.Int64("userId", principal.User.ID))
+		}
+		if principal.ApiAccount != nil {
+			record.AddAttrs(slog.String("apiKey", principal.ApiAccount.Key))
+		}
+	}
+
+	return h.next.Handle(ctx, record)
+}
+
+func (h ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return ContextHandler{next: h.next.WithAttrs(attrs)}
+}
+
+func (h ContextHandler) WithGroup(name string) slog.Handler {
+	return ContextHandler{next: h.next.WithGroup(name)}
+}
@@ -0,0 +1,82 @@
+// Package logging is the log/slog layer of the SDK. Records are enriched from context.Context
+// (trace id, route, user and api key of the request), the level can be changed at runtime.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Level is the level of loggers created by New, LOG_LEVEL by default.
+var Level = &slog.LevelVar{}
+
+func init() {
+	if level, err := ParseLevel(os.Getenv("LOG_LEVEL")); err == nil {
+		Level.Set(level)
+	}
+}
+
+type Config struct {
+	// Output defaults to os.Stderr.
+	Output io.Writer
+	// Json defaults to true outside of DEV.
+	Json *bool
+	// Level defaults to the package Level.
+	Level slog.Leveler
+}
+
+// New creates a logger with ContextHandler over a JSON or text handler.
+func New(config Config) *slog.Logger {
+	if config.Output == nil {
+		config.Output = os.Stderr
+	}
+	if config.Level == nil {
+		config.Level = Level
+	}
+
+	isJson := strings.ToUpper(os.Getenv("ENVIRONMENT")) != "DEV"
+	if config.Json != nil {
+		isJson = *config.Json
+	}
+
+	options := &slog.HandlerOptions{Level: config.Level}
+	var handler slog.Handler = slog.NewTextHandler(config.Output, options)
+	if isJson {
+		handler = slog.NewJSONHandler(config.Output, options)
+	}
+
+	return slog.New(NewContextHandler(handler))
+}
+
+// ParseLevel accepts debug, info, warn, warning and error in any case, empty string is info.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if strings.EqualFold(s, "warning") {
+		s = "warn"
+	}
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+type attrsKey struct{}
+
+// ContextWith adds attributes to all records logged with ctx.
+func ContextWith(ctx context.Context, attrs ...slog.Attr) context.Context {
+	previous, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	merged := make([]slog.Attr, 0, len(previous)+len(attrs))
+	merged = append(merged, previous...)
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, attrsKey{}, merged)
+}
+
+func attrsFromContext(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
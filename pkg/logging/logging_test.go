@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/iteais/sdk/pkg/auth"
+	"github.com/iteais/sdk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newJsonLogger(level slog.Leveler) (*slog.Logger, *bytes.Buffer) {
+	isJson := true
+	var buf bytes.Buffer
+	return New(Config{Output: &buf, Json: &isJson, Level: level}), &buf
+}
+
+func lastRecord(t *testing.T, buf *bytes.Buffer) map[string]any {
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(lines[len(lines)-1], &record))
+	return record
+}
+
+func TestContextHandler(t *testing.T) {
+	logger, buf := newJsonLogger(slog.LevelInfo)
+
+	ctx := ContextWith(context.Background(), slog.String("traceId", "trace-1"))
+	ctx = ContextWith(ctx, slog.String("route", "/event/:id"))
+	ctx = auth.WithPrincipal(ctx, &auth.Principal{
+		User:       &models.User{ID: 7},
+		ApiAccount: &models.ApiAccount{Key: "key"},
+	})
+
+	logger.InfoContext(ctx, "event updated", "eventId", 3)
+
+	record := lastRecord(t, buf)
+	assert.Equal(t, "event updated", record["msg"])
+	assert.Equal(t, "trace-1", record["traceId"])
+	assert.Equal(t, "/event/:id", record["route"])
+	assert.Equal(t, 7.0, record["userId"])
+	assert.Equal(t, "key", record["apiKey"])
+	assert.Equal(t, 3.0, record["eventId"])
+
+	logger.Info("no context")
+	assert.NotContains(t, lastRecord(t, buf), "traceId")
+}
+
+func TestLogrusHook(t *testing.T) {
+	level := &slog.LevelVar{}
+	logger, buf := newJsonLogger(level)
+	l := NewLogrus(logger)
+
+	ctx := ContextWith(context.Background(), slog.String("traceId", "trace-1"))
+	l.WithContext(ctx).WithError(errors.New("boom")).WithField("job", "sync").Warn("job failed")
+
+	record := lastRecord(t, buf)
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "job failed", record["msg"])
+	assert.Equal(t, "boom", record["error"])
+	assert.Equal(t, "sync", record["job"])
+	assert.Equal(t, "trace-1", record["traceId"])
+
+	// Уровень задается slog и меняется на лету
+	l.Debug("hidden")
+	assert.Equal(t, "job failed", lastRecord(t, buf)["msg"])
+
+	level.Set(slog.LevelDebug)
+	l.Debug("visible")
+	assert.Equal(t, "visible", lastRecord(t, buf)["msg"])
+}
+
+func TestParseLevel(t *testing.T) {
+	for input, expected := range map[string]slog.Level{
+		"":        slog.LevelInfo,
+		"debug":   slog.LevelDebug,
+		"WARNING": slog.LevelWarn,
+		"error":   slog.LevelError,
+	} {
+		level, err := ParseLevel(input)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, level, input)
+	}
+
+	_, err := ParseLevel("verbose")
+	assert.Error(t, err)
+}
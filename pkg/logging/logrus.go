@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogrusHook sends logrus entries to a slog logger, so code written for logrus.FieldLogger
+// gets the same output, level and context attributes. Entry.Context is used for WithContext entries.
+type LogrusHook struct {
+	handler slog.Handler
+}
+
+func NewLogrusHook(logger *slog.Logger) *LogrusHook {
+	return &LogrusHook{handler: logger.Handler()}
+}
+
+func (h *LogrusHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *LogrusHook) Fire(entry *logrus.Entry) error {
+	ctx := entry.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	level := slogLevel(entry.Level)
+	if !h.handler.Enabled(ctx, level) {
+		return nil
+	}
+
+	record := slog.NewRecord(entry.Time, level, entry.Message, 0)
+
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := entry.Data[key]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		record.AddAttrs(slog.Any(key, value))
+	}
+
+	return h.handler.Handle(ctx, record)
+}
+
+// UseSlog routes all entries of l to logger. The level is checked by logger, so l accepts every level
+// and changes of Level apply to logrus too.
+func UseSlog(l *logrus.Logger, logger *slog.Logger) *logrus.Logger {
+	l.SetOutput(io.Discard)
+	l.SetFormatter(discardFormatter{})
+	l.SetLevel(logrus.TraceLevel)
+	l.ReplaceHooks(logrus.LevelHooks{})
+	l.AddHook(NewLogrusHook(logger))
+	return l
+}
+
+// NewLogrus returns a logrus logger writing to logger, e.g. for HttpLogger or jobs.NewManager.
+func NewLogrus(logger *slog.Logger) *logrus.Logger {
+	return UseSlog(logrus.New(), logger)
+}
+
+func slogLevel(level logrus.Level) slog.Level {
+	switch level {
+	case logrus.TraceLevel:
+		return slog.LevelDebug - 4
+	case logrus.DebugLevel:
+		return slog.LevelDebug
+	case logrus.InfoLevel:
+		return slog.LevelInfo
+	case logrus.WarnLevel:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// discardFormatter skips formatting, the entry is written by LogrusHook.
+type discardFormatter struct{}
+
+func (discardFormatter) Format(*logrus.Entry) ([]byte, error) {
+	return nil, nil
+}
@@ -0,0 +1,79 @@
+// Package metrics registers service metrics with a common namespace.
+package metrics
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// Registry creates metrics named <namespace>_<name>. Registering the same metric twice returns
+// the existing collector, so metrics can be created where they are used.
+//
+//	orders := app.Metrics.Counter("orders_total", "Created orders.", "status")
+//	orders.WithLabelValues("paid").Inc()
+type Registry struct {
+	namespace  string
+	registerer prometheus.Registerer
+}
+
+// NewRegistry uses the default Prometheus registry served by AppendMetrics when registerer is nil.
+func NewRegistry(namespace string, registerer prometheus.Registerer) *Registry {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	return &Registry{namespace: Namespace(namespace), registerer: registerer}
+}
+
+// Namespace converts an application name like "event-service" to a metric prefix "event_service".
+func Namespace(name string) string {
+	return strings.ToLower(invalidNameChars.ReplaceAllString(name, "_"))
+}
+
+func (r *Registry) Counter(name string, help string, labels ...string) *prometheus.CounterVec {
+	return register(r.registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: r.namespace,
+		Name:      name,
+		Help:      help,
+	}, labels))
+}
+
+func (r *Registry) Gauge(name string, help string, labels ...string) *prometheus.GaugeVec {
+	return register(r.registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: r.namespace,
+		Name:      name,
+		Help:      help,
+	}, labels))
+}
+
+// Histogram uses prometheus.DefBuckets when buckets is nil.
+func (r *Registry) Histogram(name string, help string, buckets []float64, labels ...string) *prometheus.HistogramVec {
+	return register(r.registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: r.namespace,
+		Name:      name,
+		Help:      help,
+		Buckets:   buckets,
+	}, labels))
+}
+
+// Register adds a custom collector, e.g. prometheus.NewGaugeFunc. It panics on invalid metrics.
+func (r *Registry) Register(collector prometheus.Collector) prometheus.Collector {
+	return register(r.registerer, collector)
+}
+
+func register[T prometheus.Collector](registerer prometheus.Registerer, collector T) T {
+	if err := registerer.Register(collector); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if errors.As(err, &registered) {
+			if existing, ok := registered.ExistingCollector.(T); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return collector
+}
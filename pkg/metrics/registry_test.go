@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics := NewRegistry("event-service", registry)
+
+	orders := metrics.Counter("orders_total", "Created orders.", "status")
+	orders.WithLabelValues("paid").Inc()
+
+	// The same metric created again is shared
+	metrics.Counter("orders_total", "Created orders.", "status").WithLabelValues("paid").Inc()
+	assert.Equal(t, 2.0, testutil.ToFloat64(orders.WithLabelValues("paid")))
+
+	metrics.Histogram("sync_duration_seconds", "Sync duration.", nil).WithLabelValues().Observe(0.3)
+	metrics.Gauge("queue_size", "Queue size.").WithLabelValues().Set(5)
+
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+
+	names := make([]string, 0, len(families))
+	for _, family := range families {
+		names = append(names, family.GetName())
+	}
+	assert.ElementsMatch(t, []string{"event_service_orders_total", "event_service_sync_duration_seconds", "event_service_queue_size"}, names)
+
+	// Same name with other labels is a programming error
+	assert.Panics(t, func() {
+		metrics.Counter("orders_total", "Created orders.", "currency")
+	})
+}
@@ -1,8 +1,10 @@
 package pkg
 
 import (
-	"encoding/json"
+	"bytes"
+	"errors"
 	"io"
+	"log/slog"
 	"net"
 	"net/http"
 	"regexp"
@@ -11,10 +13,16 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/iteais/sdk/pkg/auth"
+	"github.com/iteais/sdk/pkg/logging"
 	"github.com/iteais/sdk/pkg/models"
+	"github.com/iteais/sdk/pkg/tracing"
 	"github.com/iteais/sdk/pkg/utils"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -22,24 +30,21 @@ const (
 	TraceIdHttpHeader = "X-Trace-Id"
 	UserContextKey    = "user"
 	RolesContextKey   = "roles"
+	// ApiAccountContextKey holds the models.ApiAccount verified by HmacMiddleware, without the secret.
+	ApiAccountContextKey = "apiAccount"
+	// HmacBypassContextKey holds the trusted network of a client which skipped the signature check.
+	HmacBypassContextKey = "hmacBypass"
+
+	ApiKeyHttpHeader         = "Api-Key"
+	ApiSignHttpHeader        = "Api-Sign"
+	ApiTimeHttpHeader        = "Api-Time"
+	ApiSignVersionHttpHeader = "Api-Sign-Version"
+	ApiNonceHttpHeader       = "Api-Nonce"
+
+	// defaultMaxSignedBody limits bodies read before the signature is checked.
+	defaultMaxSignedBody = 10 << 20
 )
 
-func CorsMiddleware() func(c *gin.Context) {
-	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-
-		c.Next()
-	}
-}
-
 func JsonMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Content-Type", "application/json")
@@ -47,29 +52,116 @@ func JsonMiddleware() gin.HandlerFunc {
 	}
 }
 
+// TraceMiddleware Продолжает трассировку из traceparent (или X-Trace-Id) и создает span запроса.
+// X-Trace-Id содержит trace id в формате UUID, если клиент не передал свой.
 func TraceMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		tid := c.GetHeader(TraceIdHttpHeader)
 
+		ctx := tracing.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		if !trace.SpanContextFromContext(ctx).IsValid() && tid != "" {
+			ctx = tracing.ContextWithTraceId(ctx, tid)
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = UnmatchedRoute
+		}
+
+		ctx, span := tracing.Tracer().Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(c.FullPath()),
+				semconv.URLPath(c.Request.URL.Path),
+				semconv.ClientAddress(c.ClientIP()),
+				semconv.UserAgentOriginal(c.Request.UserAgent()),
+			))
+		defer span.End()
+
+		if tid == "" {
+			tid = tracing.TraceId(ctx)
+		}
 		if tid == "" {
 			tid = uuid.New().String()
 		}
 
 		c.Set(TraceIdContextKey, tid)
+		c.Header(TraceIdHttpHeader, tid)
+		ctx = logging.ContextWith(ctx, slog.String("traceId", tid))
+		if c.FullPath() != "" {
+			ctx = logging.ContextWith(ctx, slog.String("route", c.FullPath()))
+		}
+		c.Request = c.Request.WithContext(ctx)
 
 		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		for _, err := range c.Errors {
+			span.RecordError(err.Err)
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
 	}
 }
 
-type hmacResponse struct {
-	Cnt   int
-	Data  models.ApiAccount
-	Error string
+type HmacConfig struct {
+	// Resolver finds accounts by Api-Key. Required.
+	Resolver AccountResolver
+	// WhiteList of path regexps which do not require a signature. "*" disables the check.
+	WhiteList []string
+	// DisableV1 rejects requests signed with the legacy sha256(key + time + secret) hash.
+	DisableV1 bool
+	// ClockSkew is the accepted difference between Api-Time and the server time. Default 2m.
+	ClockSkew time.Duration
+	// Nonces enables replay protection with the Api-Nonce header. Default in-memory store.
+	Nonces NonceStore
+	// RequireNonce rejects signed requests without Api-Nonce. Only v2 signatures cover the nonce:
+	// a v1 request can be replayed with a new nonce until Api-Time leaves ClockSkew, set DisableV1 to prevent it.
+	RequireNonce bool
+	// TrustedNetworks are CIDRs or IPs (IPv4 and IPv6) whose clients skip the signature check.
+	// None by default, loopback included: behind a local proxy every client would look trusted.
+	TrustedNetworks []string
+	// DisableTrustedBypass ignores TrustedNetworks, every client must sign requests.
+	DisableTrustedBypass bool
+	// MaxBodySize of requests signed with v2, the body is read before the signature is checked.
+	// Larger requests get 413. Default 10MB.
+	MaxBodySize int64
 }
 
 // HmacMiddleware Проверка подписи запроса
 func HmacMiddleware(checkHost string, whiteList ...string) gin.HandlerFunc {
+	return HmacMiddlewareWithConfig(HmacConfig{
+		Resolver:  NewCachedAccountResolver(NewHttpAccountResolver(checkHost), CachedAccountResolverConfig{}),
+		WhiteList: whiteList,
+	})
+}
+
+// HmacMiddlewareWithConfig Проверка подписи запроса
+func HmacMiddlewareWithConfig(config HmacConfig) gin.HandlerFunc {
+	whiteList := config.WhiteList
+
+	if config.ClockSkew <= 0 {
+		config.ClockSkew = 2 * time.Minute
+	}
+	if config.Nonces == nil {
+		config.Nonces = NewMemoryNonceStore()
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = defaultMaxSignedBody
+	}
+
+	var trusted []*net.IPNet
+	if !config.DisableTrustedBypass {
+		var err error
+		if trusted, err = utils.ParseNetworks(config.TrustedNetworks); err != nil {
+			panic(err)
+		}
+	}
+
 	return func(c *gin.Context) {
 
 		if slices.Contains(whiteList, "*") {
@@ -77,23 +169,15 @@ func HmacMiddleware(checkHost string, whiteList ...string) gin.HandlerFunc {
 			return
 		}
 
-		clientIP := c.ClientIP()
-
-		if clientIP == "::1" || clientIP == "127.0.0.1" {
+		// ClientIP only honours forwarding headers of ApplicationConfig.TrustedProxies.
+		if network := utils.FindNetwork(net.ParseIP(c.ClientIP()), trusted); network != nil {
+			c.Set(HmacBypassContextKey, network.String())
 			c.Next()
 			return
 		}
 
-		localIps := utils.LocalIps()
-		clientIp := net.ParseIP(c.ClientIP())
-		for localIp := range localIps {
-			if utils.CheckIpsInSameSubnet(clientIp, localIps[localIp]) {
-				c.Next()
-				return
-			}
-		}
-
-		wl := append([]string{MetricsEndpoint, HealthEndpoint, ReadyEndpoint, SwaggerEndpoint}, whiteList...)
+		// Встроенные маршруты привязаны к началу пути, иначе "/health" открыл бы и "/admin/health"
+		wl := append([]string{"^" + MetricsEndpoint, "^" + HealthEndpoint, "^" + ReadyEndpoint, "^" + SwaggerEndpoint}, whiteList...)
 
 		for _, s := range wl {
 			if ok, _ := regexp.MatchString(s, c.Request.URL.Path); ok {
@@ -102,45 +186,30 @@ func HmacMiddleware(checkHost string, whiteList ...string) gin.HandlerFunc {
 			}
 		}
 
-		key := c.Request.Header.Get("Api-Key")
-		Sign := c.Request.Header.Get("Api-Sign")
-		Time := c.Request.Header.Get("Api-Time")
+		key := c.Request.Header.Get(ApiKeyHttpHeader)
+		Sign := c.Request.Header.Get(ApiSignHttpHeader)
+		Time := c.Request.Header.Get(ApiTimeHttpHeader)
+		nonce := c.Request.Header.Get(ApiNonceHttpHeader)
 
 		if key == "" || Sign == "" || Time == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Api-Key or Api-Sign or Api-Time is empty"})
 			return
 		}
-		// TODO: may be cache it
-		resp := InternalFetch(InternalFetchConfig{
-			Method:  "GET",
-			Url:     checkHost + "/api/byKey/" + key,
-			JWT:     c.Request.Header.Get(utils.AuthHeader),
-			TraceId: c.GetString(TraceIdContextKey),
-		})
 
-		if resp == nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Cant call api service"})
+		if nonce == "" && config.RequireNonce {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Api-Nonce is empty"})
 			return
 		}
 
-		if resp.StatusCode != http.StatusOK {
-			// TODO: may be 403 or 401
-			c.AbortWithStatusJSON(resp.StatusCode, gin.H{"message": "Api service return status code: " + strconv.Itoa(resp.StatusCode)})
-			return
-		}
+		account, err := config.Resolver.Resolve(c, key)
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			// TODO: may be 400
-			c.AbortWithStatusJSON(resp.StatusCode, gin.H{"message": "Api service read response body error: " + err.Error()})
+		if errors.Is(err, ErrApiAccountNotFound) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Api-Key is unknown"})
 			return
 		}
 
-		var account hmacResponse
-		err = json.Unmarshal(body, &account)
 		if err != nil {
-			// TODO: may be 400
-			c.AbortWithStatusJSON(resp.StatusCode, gin.H{"message": "Api service unmarshal response body error: " + err.Error()})
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Cant call api service: " + err.Error()})
 			return
 		}
 
@@ -148,61 +217,154 @@ func HmacMiddleware(checkHost string, whiteList ...string) gin.HandlerFunc {
 
 		checkTime := utils.SliceString(Time)
 		unixTimestampSeconds, err := strconv.ParseInt(checkTime, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Api-Time is not a unix timestamp"})
+			return
+		}
 		requestTime := time.Unix(unixTimestampSeconds, 0)
 
-		past := now.Add(-2 * time.Minute).Unix()
+		past := now.Add(-config.ClockSkew).Unix()
 		requestTimestamp := requestTime.Unix()
-		future := now.Add(2 * time.Minute).Unix()
+		future := now.Add(config.ClockSkew).Unix()
 
 		if past > requestTimestamp || requestTimestamp > future {
-			c.AbortWithStatusJSON(419, gin.H{"message": "Request has incorrect signature"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Api-Time is outside of the allowed window"})
 			return
 		}
 
-		if account.Data.CanHandleWithHash(Sign, Time) == false {
+		var approved bool
+		switch c.Request.Header.Get(ApiSignVersionHttpHeader) {
+		case "", "1":
+			if config.DisableV1 {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Api-Sign-Version 1 is disabled"})
+				return
+			}
+			approved = account.CanHandleWithHash(Sign, Time)
+		case "2":
+			body, ok := readBody(c, config.MaxBodySize)
+			if !ok {
+				return
+			}
+
+			canonical := utils.CanonicalRequest(c.Request.Method, c.Request.URL.Path, c.Request.URL.Query(), body, Time, nonce)
+			approved = account.CanHandleWithSignature(Sign, canonical)
+		default:
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Api-Sign-Version is not supported"})
+			return
+		}
+
+		if approved == false {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Api service not approve request"})
 			return
 		}
 
+		if account.CanAccess(c.Request.Method, c.Request.URL.Path) == false {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Api-Key has no access to this route"})
+			return
+		}
+
+		if nonce != "" {
+			// A nonce is only checked after the signature, so it can not be burned by an unsigned request.
+			// It must be kept while the request time is accepted, which is up to twice the skew.
+			fresh, err := config.Nonces.Use(c, key+":"+nonce, 2*config.ClockSkew)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Cant check Api-Nonce: " + err.Error()})
+				return
+			}
+			if !fresh {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Api-Nonce is already used"})
+				return
+			}
+		}
+
+		verified := *account
+		verified.Secret = ""
+		c.Set(ApiAccountContextKey, verified)
+
+		principal := &auth.Principal{}
+		if current, ok := auth.PrincipalFromContext(c); ok {
+			copied := *current
+			principal = &copied
+		}
+		principal.ApiAccount = &verified
+		setPrincipal(c, principal)
+
 		c.Next()
 	}
 }
 
+// readBody reads at most limit bytes of the request body and puts them back for the handler.
+// Larger bodies get 413, the request is aborted and false is returned.
+func readBody(c *gin.Context, limit int64) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"message": "Request body is too large"})
+		} else {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "Cant read request body"})
+		}
+		return nil, false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true
+}
+
 // UserMiddleware Добавляет в контекст информацию о текущем пользователе
 func UserMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		current, err := utils.GetRequestJwt(c)
-
-		if err == nil {
-
-			claims := current.Claims.(jwt.MapClaims)
+	return UserMiddlewareWithVerifier(auth.NewVerifier(auth.VerifierConfigFromEnv()))
+}
 
-			if userMap, ok := claims["user"].(map[string]interface{}); ok {
+// UserMiddlewareWithVerifier Добавляет в контекст информацию о текущем пользователе, токен проверяется verifier
+func UserMiddlewareWithVerifier(verifier *auth.Verifier) gin.HandlerFunc {
+	return UserMiddlewareWithClaims[auth.AccessClaims](verifier)
+}
 
-				var user models.User
-				jsonData, err := json.Marshal(userMap)
+// UserMiddlewareWithClaims Добавляет в контекст Principal из токена с claims типа T, см. CurrentClaims.
+// Запрос без токена проходит анонимно, с невалидным токеном получает 401, кроме маршрутов Application.AppendAuth.
+//
+//	type Claims struct {
+//		auth.AccessClaims
+//		TenantId int64 `json:"tenant_id"`
+//	}
+//	router.Use(pkg.UserMiddlewareWithClaims[Claims](verifier))
+func UserMiddlewareWithClaims[T any, PT interface {
+	*T
+	auth.PrincipalClaims
+}](verifier *auth.Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := verifier.TokenFromRequest(c.Request)
+		if tokenString == "" {
+			c.Next()
+			return
+		}
 
-				if err == nil {
-					err = json.Unmarshal(jsonData, &user)
-					if err == nil {
-						c.Set(UserContextKey, user)
-					}
-				}
+		claims := PT(new(T))
+		if _, err := verifier.VerifyWithClaims(c, tokenString, claims); err != nil {
+			// Просроченный токен не должен мешать его обновлению и выходу
+			if App != nil && App.tokenOptionalRoutes[c.Request.Method+" "+c.FullPath()] {
+				c.Next()
+				return
 			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "User-Jwt is invalid"})
+			return
+		}
 
-			if rolesMap, ok := claims["roles"].([]interface{}); ok {
-				var roles []models.Role
-				jsonData, err := json.Marshal(rolesMap)
-				if err == nil {
-					err = json.Unmarshal(jsonData, &roles)
-					if err == nil {
-						c.Set(RolesContextKey, roles)
-					}
-				}
-			}
+		principal := claims.Principal()
+		principal.Claims = claims
+		if current, ok := auth.PrincipalFromContext(c); ok {
+			principal.ApiAccount = current.ApiAccount
+		}
+		setPrincipal(c, principal)
 
-			c.Next()
+		if principal.User != nil {
+			c.Set(UserContextKey, *principal.User)
+		}
+		if principal.Roles != nil {
+			c.Set(RolesContextKey, principal.Roles)
 		}
+
+		c.Next()
 	}
 }
 
@@ -240,6 +402,25 @@ func RoleMiddleware(roles ...string) gin.HandlerFunc {
 	}
 }
 
+// ApiRoleMiddleware Разрешает доступ только API-ключам с одной из ролей, проверенным HmacMiddleware
+// internal := router.Group("/internal", ApiRoleMiddleware("service"))
+func ApiRoleMiddleware(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		account, e := c.Get(ApiAccountContextKey)
+		if e == false {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "You are not authorized"})
+			return
+		}
+
+		if slices.Contains(roles, account.(models.ApiAccount).Role) {
+			c.Next()
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "You has no access"})
+	}
+}
+
 func AuthOnlyMiddleWare() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
@@ -1,18 +1,50 @@
 package models
 
 import (
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"regexp"
+	"slices"
+	"strings"
 )
 
 type ApiAccount struct {
-	ID          int64  `json:"id"`
-	Key         string `json:"key"`
-	Secret      string `json:"secret"`
-	Role        string `json:"role"`
-	Block       bool   `json:"block"`
-	BlockReason string `json:"block_reason"`
-	Comment     string `json:"comment"`
+	ID          int64      `json:"id"`
+	Key         string     `json:"key"`
+	Secret      string     `json:"secret"`
+	Role        string     `json:"role"`
+	Block       bool       `json:"block"`
+	BlockReason string     `json:"block_reason"`
+	Comment     string     `json:"comment"`
+	Scopes      []ApiScope `json:"scopes"`
+}
+
+// ApiScope allows requests whose path matches the Path regexp with one of Methods.
+// Empty Methods allow any method.
+type ApiScope struct {
+	Path    string   `json:"path" example:"^/user/"`
+	Methods []string `json:"methods" example:"GET"`
+}
+
+// CanAccess checks the request against the account scopes. An account without scopes can access any route.
+func (a ApiAccount) CanAccess(method string, path string) bool {
+	if len(a.Scopes) == 0 {
+		return true
+	}
+
+	for _, scope := range a.Scopes {
+		if len(scope.Methods) > 0 && !slices.ContainsFunc(scope.Methods, func(m string) bool {
+			return strings.EqualFold(m, method)
+		}) {
+			continue
+		}
+		if ok, _ := regexp.MatchString(scope.Path, path); ok {
+			return true
+		}
+	}
+
+	return false
 }
 
 // CanHandleWithHash verifies if the provided hash matches the expected hash for the given time.
@@ -21,7 +53,7 @@ func (a ApiAccount) CanHandleWithHash(hash string, time string) bool {
 	if a.Block {
 		return false
 	}
-	return hash == a.GetHash(time)
+	return hmac.Equal([]byte(hash), []byte(a.GetHash(time)))
 }
 
 // GetHash generates a SHA-256 hash based on the account's key, secret, and the provided time.
@@ -33,3 +65,19 @@ func (a ApiAccount) GetHash(time string) string {
 
 	return hex.EncodeToString(hasher.Sum(nil))
 }
+
+// CanHandleWithSignature verifies a v2 signature of the canonical request string, see utils.CanonicalRequest.
+func (a ApiAccount) CanHandleWithSignature(signature string, canonical string) bool {
+	if a.Block {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(a.GetSignature(canonical)))
+}
+
+// GetSignature generates a v2 signature: hex encoded HMAC-SHA256 of the canonical request keyed by the secret.
+func (a ApiAccount) GetSignature(canonical string) string {
+	mac := hmac.New(sha256.New, []byte(a.Secret))
+	mac.Write([]byte(canonical))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -85,3 +85,59 @@ func TestApiAccount_CanHandleWithHash(t *testing.T) {
 		})
 	}
 }
+
+func TestApiAccount_CanHandleWithSignature(t *testing.T) {
+	account := ApiAccount{Key: "test-key", Secret: "test-secret"}
+	canonical := "GET\n/user/1\n\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n1700000000"
+	signature := account.GetSignature(canonical)
+
+	tests := []struct {
+		name      string
+		account   ApiAccount
+		signature string
+		canonical string
+		want      bool
+	}{
+		{name: "valid_signature", account: account, signature: signature, canonical: canonical, want: true},
+		{name: "other_request", account: account, signature: signature, canonical: canonical + "1", want: false},
+		{name: "other_secret", account: ApiAccount{Key: "test-key", Secret: "other"}, signature: signature, canonical: canonical, want: false},
+		{name: "blocked", account: ApiAccount{Key: "test-key", Secret: "test-secret", Block: true}, signature: signature, canonical: canonical, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.account.CanHandleWithSignature(tt.signature, tt.canonical); got != tt.want {
+				t.Errorf("CanHandleWithSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApiAccount_CanAccess(t *testing.T) {
+	account := ApiAccount{Scopes: []ApiScope{
+		{Path: "^/user/", Methods: []string{"GET"}},
+		{Path: "^/event$"},
+	}}
+
+	tests := []struct {
+		name    string
+		account ApiAccount
+		method  string
+		path    string
+		want    bool
+	}{
+		{name: "no_scopes", account: ApiAccount{}, method: "DELETE", path: "/user/1", want: true},
+		{name: "method_allowed", account: account, method: "get", path: "/user/1", want: true},
+		{name: "method_denied", account: account, method: "POST", path: "/user/1", want: false},
+		{name: "any_method", account: account, method: "POST", path: "/event", want: true},
+		{name: "path_denied", account: account, method: "GET", path: "/event/1", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.account.CanAccess(tt.method, tt.path); got != tt.want {
+				t.Errorf("CanAccess() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -19,3 +19,11 @@ type Event struct {
 	CreatedBy     int    `json:"created_by"`
 	SendRegEmail  bool   `json:"send_reg_email"`
 }
+
+func (e Event) OwnerId() int64 {
+	return int64(e.CreatedBy)
+}
+
+func (e Event) OwnerColumn() string {
+	return "created_by"
+}
@@ -17,6 +17,23 @@ type ModelLastModified interface {
 	LastModifiedField() string
 }
 
+// ModelStreamed models publish "created" and "updated" events from CreateAction and
+// UpdateAction to the returned topic of App.Stream. Subscribers need the "<topic>.read" permission,
+// "<topic>.read:own" for models of ModelOwned.
+type ModelStreamed interface {
+	StreamTopic() string
+}
+
+// ModelOwned models can be checked by "own" permissions like "event.update:own", see auth.Policy.
+type ModelOwned interface {
+	OwnerId() int64
+}
+
+// ModelOwnerColumn models are filtered by "own" permissions in the query of ListAction, see auth.Policy.Scope.
+type ModelOwnerColumn interface {
+	OwnerColumn() string
+}
+
 func LoadModel[T interface{}](c *gin.Context, model T, errorMessages map[string]string) (T, map[string][]string) {
 	if err := c.ShouldBindJSON(&model); err != nil {
 		var ve validator.ValidationErrors
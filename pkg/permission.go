@@ -0,0 +1,231 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/auth"
+	"github.com/iteais/sdk/pkg/models"
+	log "github.com/sirupsen/logrus"
+	"github.com/uptrace/bun"
+)
+
+// PendingPermissionsContextKey holds permissions granted only with a condition, e.g. "event.update:own".
+// They are checked by AuthorizeModel when the model is loaded.
+const PendingPermissionsContextKey = "pendingPermissions"
+
+// Can Проверяет разрешение текущего пользователя или API-ключа на resource, resource может быть nil
+func Can(c *gin.Context, permission string, resource any) bool {
+	if App == nil || App.Policy == nil {
+		return false
+	}
+	return App.Policy.Can(CurrentPrincipal(c), permission, resource)
+}
+
+// PermissionMiddleware Разрешает доступ по правам ролей из App.Policy
+// authorized := router.Group("/events", PermissionMiddleware("event.update"))
+func PermissionMiddleware(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if App == nil || App.Policy == nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "You has no access"})
+			return
+		}
+		PermissionMiddlewareWithPolicy(App.Policy, permission)(c)
+	}
+}
+
+// PermissionMiddlewareWithPolicy Разрешает доступ по правам ролей из policy.
+// Условные права ("event.update:own") проверяются в AuthorizeModel, AuthorizeQuery или FilterAuthorized.
+// Если обработчик их не проверил, вместо успешного ответа отдается 403.
+func PermissionMiddlewareWithPolicy(policy *auth.Policy, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		decision := policy.Explain(CurrentPrincipal(c), permission, nil)
+
+		if decision.Allowed {
+			c.Next()
+			return
+		}
+
+		if decision.Conditional {
+			pending := pendingPermissions(c)
+			if pending == nil {
+				c.Writer = &permissionGuardWriter{ResponseWriter: c.Writer, c: c}
+			}
+			pending = append(pending, &pendingPermission{policy: policy, permission: permission, decision: decision})
+			c.Set(PendingPermissionsContextKey, pending)
+			c.Next()
+
+			// Ответ без тела (c.Status) gin отправит сам уже после middleware
+			if !c.Writer.Written() && c.Writer.Status() < http.StatusBadRequest {
+				denyUnchecked(c, c.Writer)
+			}
+			return
+		}
+
+		abortForbidden(c, decision)
+	}
+}
+
+// AuthorizeModel checks conditional permissions of PermissionMiddleware against the loaded model.
+// It aborts the request with 403 and returns false if they are not met.
+//
+//	if !pkg.AuthorizeModel(c, &event) { return }
+func AuthorizeModel(c *gin.Context, model any) bool {
+	for _, pending := range pendingPermissions(c) {
+		pending.checked = true
+		decision := pending.policy.Explain(CurrentPrincipal(c), pending.permission, model)
+		if !decision.Allowed {
+			abortForbidden(c, decision)
+			return false
+		}
+	}
+	return true
+}
+
+// AuthorizeQuery limits query to models which meet conditional permissions of PermissionMiddleware,
+// e.g. to own events for "event.read:own", so counts and pages come from the filtered query.
+// It aborts the request with 403 and returns false if the conditions can not be applied to the query.
+//
+//	if !pkg.AuthorizeQuery(c, query, new(models.Event)) { return }
+func AuthorizeQuery(c *gin.Context, query *bun.SelectQuery, model any) bool {
+	for _, pending := range pendingPermissions(c) {
+		pending.checked = true
+		decision := pending.policy.Scope(CurrentPrincipal(c), pending.permission, query, model)
+		if !decision.Allowed {
+			abortForbidden(c, decision)
+			return false
+		}
+	}
+	return true
+}
+
+// FilterAuthorized returns models which meet conditional permissions of PermissionMiddleware,
+// e.g. own events for "event.read:own". Unlike AuthorizeModel it does not abort the request.
+func FilterAuthorized[T any](c *gin.Context, list []T) []T {
+	pending := pendingPermissions(c)
+	if len(pending) == 0 {
+		return list
+	}
+
+	for _, p := range pending {
+		p.checked = true
+	}
+
+	principal := CurrentPrincipal(c)
+	authorized := make([]T, 0, len(list))
+	for i := range list {
+		allowed := true
+		for _, p := range pending {
+			if !p.policy.Can(principal, p.permission, &list[i]) {
+				allowed = false
+				break
+			}
+		}
+		if allowed {
+			authorized = append(authorized, list[i])
+		}
+	}
+	return authorized
+}
+
+// AppendPermissionExplain explains a permission check for the current principal or for the given roles:
+// GET /admin/permissions/explain?permission=event.update&role=user. The endpoint is protected by HmacMiddleware.
+func (a *Application) AppendPermissionExplain() *Application {
+	a.AppendGetEndpoint(PermissionExplainEndpoint, func(c *gin.Context) {
+		principal := CurrentPrincipal(c)
+
+		if roles := c.QueryArray("role"); len(roles) > 0 {
+			principal = &auth.Principal{User: &models.User{}}
+			for _, role := range roles {
+				principal.Roles = append(principal.Roles, models.Role{Title: role})
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": a.Policy.Explain(principal, c.Query("permission"), nil)})
+	})
+	return a
+}
+
+type pendingPermission struct {
+	policy     *auth.Policy
+	permission string
+	decision   auth.Decision
+	checked    bool
+}
+
+func pendingPermissions(c *gin.Context) []*pendingPermission {
+	if pending, ok := c.Get(PendingPermissionsContextKey); ok {
+		return pending.([]*pendingPermission)
+	}
+	return nil
+}
+
+func uncheckedPermission(c *gin.Context) *pendingPermission {
+	for _, pending := range pendingPermissions(c) {
+		if !pending.checked {
+			return pending
+		}
+	}
+	return nil
+}
+
+// permissionGuardWriter replaces a successful response with 403 while conditional permissions are not checked.
+type permissionGuardWriter struct {
+	gin.ResponseWriter
+	c      *gin.Context
+	denied bool
+}
+
+func (w *permissionGuardWriter) Write(data []byte) (int, error) {
+	if w.denied {
+		return len(data), nil
+	}
+	if !w.ResponseWriter.Written() && w.ResponseWriter.Status() < http.StatusBadRequest && denyUnchecked(w.c, w.ResponseWriter) {
+		w.denied = true
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *permissionGuardWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// denyUnchecked writes 403 to w, the underlying writer, if a conditional permission was not checked.
+func denyUnchecked(c *gin.Context, w gin.ResponseWriter) bool {
+	pending := uncheckedPermission(c)
+	if pending == nil {
+		return false
+	}
+
+	logger := log.WithField(TraceIdContextKey, c.GetString(TraceIdContextKey))
+	if App != nil {
+		logger = App.GetRequestLogger(c)
+	}
+	logger.WithField("route", c.FullPath()).
+		Errorf("conditional permission %s was not checked with AuthorizeModel, the response is denied", pending.permission)
+
+	c.Abort()
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	body, _ := json.Marshal(forbiddenBody(pending.decision))
+	_, _ = w.Write(body)
+	return true
+}
+
+func abortForbidden(c *gin.Context, decision auth.Decision) {
+	c.AbortWithStatusJSON(http.StatusForbidden, forbiddenBody(decision))
+}
+
+func forbiddenBody(decision auth.Decision) gin.H {
+	body := gin.H{"message": "You has no access", "permission": decision.Permission}
+	// Причину отказа видно только в DEV, в остальных окружениях см. AppendPermissionExplain
+	if strings.ToUpper(os.Getenv("ENVIRONMENT")) == "DEV" {
+		body["reason"] = decision.Reason
+	}
+	return body
+}
@@ -0,0 +1,239 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/auth"
+	"github.com/iteais/sdk/pkg/models"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+func TestPermissionMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("ENVIRONMENT", "DEV")
+
+	policy := auth.NewPolicy(auth.PolicyConfig{Roles: map[string][]string{
+		"admin": {"event.*"},
+		"user":  {"event.update:own"},
+	}})
+
+	events := map[string]models.Event{"1": {ID: 1, CreatedBy: 7}, "2": {ID: 2, CreatedBy: 8}}
+
+	call := func(principal *auth.Principal, id string) (int, map[string]any) {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			if principal != nil {
+				setPrincipal(c, principal)
+			}
+		})
+		router.PATCH("/events/:id", PermissionMiddlewareWithPolicy(policy, "event.update"), func(c *gin.Context) {
+			event := events[c.Param("id")]
+			if !AuthorizeModel(c, &event) {
+				return
+			}
+			c.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/events/"+id, nil))
+
+		var body map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	user := &auth.Principal{User: &models.User{ID: 7}, Roles: []models.Role{{Title: "user"}}}
+	admin := &auth.Principal{User: &models.User{ID: 1}, Roles: []models.Role{{Title: "admin"}}}
+	guest := &auth.Principal{User: &models.User{ID: 9}}
+
+	code, _ := call(admin, "2")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = call(user, "1")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, body := call(user, "2")
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "event.update", body["permission"])
+	assert.Contains(t, body["reason"], "owner 8 is not user 7")
+
+	code, _ = call(guest, "1")
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, body = call(nil, "1")
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "not authenticated", body["reason"])
+}
+
+func TestPermissionMiddlewareDeniesUncheckedConditions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	policy := auth.NewPolicy(auth.PolicyConfig{Roles: map[string][]string{
+		"admin": {"event.*"},
+		"user":  {"event.read:own"},
+	}})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		role := c.GetHeader("Role")
+		setPrincipal(c, &auth.Principal{User: &models.User{ID: 7}, Roles: []models.Role{{Title: role}}})
+	})
+	// Обработчики забыли вызвать AuthorizeModel
+	router.GET("/events/:id", PermissionMiddlewareWithPolicy(policy, "event.read"), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"data": models.Event{ID: 2, CreatedBy: 8}})
+	})
+	router.HEAD("/events/:id", PermissionMiddlewareWithPolicy(policy, "event.read"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET("/missing", PermissionMiddlewareWithPolicy(policy, "event.read"), func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{})
+	})
+
+	call := func(method, path, role string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Role", role)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := call(http.MethodGet, "/events/2", "user")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NotContains(t, w.Body.String(), "data")
+	assert.Contains(t, w.Body.String(), `"permission":"event.read"`)
+
+	assert.Equal(t, http.StatusForbidden, call(http.MethodHead, "/events/2", "user").Code)
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, "/missing", "user").Code)
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/events/2", "admin").Code)
+}
+
+func TestFilterAuthorized(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	policy := auth.NewPolicy(auth.PolicyConfig{Roles: map[string][]string{
+		"admin": {"event.*"},
+		"user":  {"event.read:own"},
+	}})
+	events := []models.Event{{ID: 1, CreatedBy: 7}, {ID: 2, CreatedBy: 8}, {ID: 3, CreatedBy: 7}}
+
+	call := func(principal *auth.Principal) (int, []models.Event) {
+		var filtered []models.Event
+		router := gin.New()
+		router.GET("/events", func(c *gin.Context) {
+			setPrincipal(c, principal)
+		}, PermissionMiddlewareWithPolicy(policy, "event.read"), func(c *gin.Context) {
+			filtered = FilterAuthorized(c, events)
+			c.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+		return w.Code, filtered
+	}
+
+	code, filtered := call(&auth.Principal{User: &models.User{ID: 7}, Roles: []models.Role{{Title: "user"}}})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []models.Event{events[0], events[2]}, filtered)
+
+	code, filtered = call(&auth.Principal{User: &models.User{ID: 1}, Roles: []models.Role{{Title: "admin"}}})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, filtered, 3)
+}
+
+func TestListActionScopesConditionalPermissions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	sqldb, err := sql.Open(sqliteshim.ShimName, "file:list_action?mode=memory&cache=shared")
+	assert.NoError(t, err)
+	db := bun.NewDB(sqldb, sqlitedialect.New())
+	defer db.Close()
+
+	ctx := context.Background()
+	_, err = db.NewCreateTable().Model((*models.Event)(nil)).Exec(ctx)
+	assert.NoError(t, err)
+	events := []models.Event{{ID: 1, CreatedBy: 7}, {ID: 2, CreatedBy: 8}, {ID: 3, CreatedBy: 8}, {ID: 4, CreatedBy: 7}, {ID: 5, CreatedBy: 7}}
+	_, err = db.NewInsert().Model(&events).Exec(ctx)
+	assert.NoError(t, err)
+
+	previous := App
+	App = &Application{Db: db, Log: logrus.New()}
+	defer func() {
+		App = previous
+	}()
+
+	policy := auth.NewPolicy(auth.PolicyConfig{Roles: map[string][]string{
+		"admin": {"event.*"},
+		"user":  {"event.read:own"},
+		"audit": {"event.read:audited"},
+	}})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		setPrincipal(c, &auth.Principal{User: &models.User{ID: 7}, Roles: []models.Role{{Title: c.GetHeader("Role")}}})
+	})
+	router.GET("/events", PermissionMiddlewareWithPolicy(policy, "event.read"), ListAction[models.Event]())
+
+	call := func(role string, page string) (*httptest.ResponseRecorder, []models.Event) {
+		r := httptest.NewRequest(http.MethodGet, "/events?per-page=2&page="+page, nil)
+		r.Header.Set("Role", role)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		var body struct {
+			Data []models.Event `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return w, body.Data
+	}
+
+	w, data := call("user", "1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, "2", w.Header().Get("x-pagination-page-count"))
+	assert.Len(t, data, 2)
+
+	w, data = call("user", "2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, data, 1)
+	for _, event := range data {
+		assert.Equal(t, 7, event.CreatedBy)
+	}
+
+	w, _ = call("admin", "1")
+	assert.Equal(t, "5", w.Header().Get("X-Total-Count"))
+
+	// Условие без формы для запроса не может ограничить список
+	w, _ = call("audit", "1")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAppendPermissionExplain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	a := &Application{
+		Router: gin.New(),
+		Policy: auth.NewPolicy(auth.PolicyConfig{Roles: map[string][]string{"user": {"event.update:own"}}}),
+	}
+	a.AppendPermissionExplain()
+
+	w := httptest.NewRecorder()
+	a.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, PermissionExplainEndpoint+"?permission=event.update&role=user", nil))
+
+	var body struct {
+		Data auth.Decision `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.True(t, body.Data.Conditional)
+	assert.Equal(t, "event.update:own", body.Data.Grant)
+	assert.Equal(t, []string{"user"}, body.Data.Roles)
+}
@@ -0,0 +1,62 @@
+package pkg
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/auth"
+	"github.com/iteais/sdk/pkg/models"
+)
+
+// PrincipalContextKey holds the *auth.Principal of the request, set by UserMiddleware and HmacMiddleware.
+const PrincipalContextKey = "principal"
+
+// CurrentPrincipal returns the authenticated caller or nil for anonymous requests.
+func CurrentPrincipal(c *gin.Context) *auth.Principal {
+	if p, ok := c.Get(PrincipalContextKey); ok {
+		return p.(*auth.Principal)
+	}
+	return nil
+}
+
+// CurrentUser returns the user from User-Jwt.
+func CurrentUser(c *gin.Context) (models.User, bool) {
+	p := CurrentPrincipal(c)
+	if p == nil || p.User == nil {
+		return models.User{}, false
+	}
+	return *p.User, true
+}
+
+// CurrentRoles returns roles of the user from User-Jwt.
+func CurrentRoles(c *gin.Context) []models.Role {
+	if p := CurrentPrincipal(c); p != nil {
+		return p.Roles
+	}
+	return nil
+}
+
+// CurrentApiAccount returns the account verified by HmacMiddleware.
+func CurrentApiAccount(c *gin.Context) (models.ApiAccount, bool) {
+	p := CurrentPrincipal(c)
+	if p == nil || p.ApiAccount == nil {
+		return models.ApiAccount{}, false
+	}
+	return *p.ApiAccount, true
+}
+
+// CurrentClaims returns the user token claims of the type passed to UserMiddlewareWithClaims.
+//
+//	claims, ok := pkg.CurrentClaims[Claims](c)
+func CurrentClaims[T any](c *gin.Context) (*T, bool) {
+	p := CurrentPrincipal(c)
+	if p == nil {
+		return nil, false
+	}
+	claims, ok := any(p.Claims).(*T)
+	return claims, ok
+}
+
+// setPrincipal stores p in the gin context and in the request context.Context for code without gin.
+func setPrincipal(c *gin.Context, p *auth.Principal) {
+	c.Set(PrincipalContextKey, p)
+	c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), p))
+}
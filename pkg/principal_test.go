@@ -0,0 +1,184 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/iteais/sdk/pkg/auth"
+	"github.com/iteais/sdk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tenantClaims struct {
+	auth.AccessClaims
+	TenantId int64 `json:"tenant_id"`
+}
+
+func signUserJwt(t *testing.T, claims jwt.Claims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	return token
+}
+
+func userClaims() auth.AccessClaims {
+	return auth.AccessClaims{
+		User:  &models.User{ID: 7, Email: "john@example.com"},
+		Roles: []models.Role{{Id: 1, Title: "admin"}},
+		Scope: "events:read events:write",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "token-1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+}
+
+func TestUserMiddleware_Principal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	verifier := auth.NewVerifier(auth.VerifierConfig{Secret: "secret"})
+
+	var principal *auth.Principal
+	var fromContext models.User
+
+	router := gin.New()
+	router.Use(UserMiddlewareWithVerifier(verifier))
+	router.GET("/", func(c *gin.Context) {
+		principal = CurrentPrincipal(c)
+		fromContext, _ = auth.UserFromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	call := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if token != "" {
+			req.Header.Set(auth.UserJwtHttpHeader, token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, call(""))
+	assert.Nil(t, principal)
+
+	assert.Equal(t, http.StatusUnauthorized, call("broken"))
+
+	expired := userClaims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	assert.Equal(t, http.StatusUnauthorized, call(signUserJwt(t, expired)))
+
+	assert.Equal(t, http.StatusOK, call(signUserJwt(t, userClaims())))
+	require.NotNil(t, principal)
+	assert.EqualValues(t, 7, principal.UserId())
+	assert.True(t, principal.HasRole("admin"))
+	assert.True(t, principal.HasScope("events:write"))
+	assert.Equal(t, "token-1", principal.TokenId)
+	assert.Equal(t, "john@example.com", fromContext.Email)
+}
+
+func TestUserMiddleware_InvalidTokenOnAuthRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	verifier := auth.NewVerifier(auth.VerifierConfig{Secret: "secret"})
+
+	previous := App
+	App = &Application{tokenOptionalRoutes: map[string]bool{"POST /auth/refresh": true}}
+	defer func() {
+		App = previous
+	}()
+
+	router := gin.New()
+	router.Use(UserMiddlewareWithVerifier(verifier))
+	router.POST("/auth/refresh", func(c *gin.Context) {
+		assert.Nil(t, CurrentPrincipal(c))
+		c.Status(http.StatusOK)
+	})
+	router.POST("/events", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	expired := userClaims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+
+	call := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set(auth.UserJwtHttpHeader, signUserJwt(t, expired))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, call("/auth/refresh").Code)
+
+	w := call("/events")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"message":"User-Jwt is invalid"}`, w.Body.String())
+}
+
+func TestUserMiddleware_CustomClaims(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	verifier := auth.NewVerifier(auth.VerifierConfig{Secret: "secret"})
+
+	router := gin.New()
+	router.Use(UserMiddlewareWithClaims[tenantClaims](verifier))
+	router.GET("/", func(c *gin.Context) {
+		claims, ok := CurrentClaims[tenantClaims](c)
+		assert.True(t, ok)
+		assert.EqualValues(t, 42, claims.TenantId)
+
+		user, ok := CurrentUser(c)
+		assert.True(t, ok)
+		assert.EqualValues(t, 7, user.ID)
+
+		// Legacy context keys keep working
+		assert.Equal(t, user, c.MustGet(UserContextKey))
+		assert.Equal(t, CurrentRoles(c), c.MustGet(RolesContextKey))
+
+		_, ok = CurrentClaims[auth.AccessClaims](c)
+		assert.False(t, ok)
+
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(auth.UserJwtHttpHeader, signUserJwt(t, tenantClaims{AccessClaims: userClaims(), TenantId: 42}))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHmacMiddleware_Principal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	verifier := auth.NewVerifier(auth.VerifierConfig{Secret: "secret"})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Request.RemoteAddr = "203.0.113.10:1234"
+	}, UserMiddlewareWithVerifier(verifier), HmacMiddlewareWithConfig(HmacConfig{
+		Resolver: staticResolver{"key": {ID: 3, Key: "key", Secret: "secret", Role: "service"}},
+	}))
+	router.POST("/", func(c *gin.Context) {
+		account, ok := CurrentApiAccount(c)
+		assert.True(t, ok)
+		assert.EqualValues(t, 3, account.ID)
+		assert.Empty(t, account.Secret)
+
+		p, ok := auth.PrincipalFromContext(context.Context(c))
+		assert.True(t, ok)
+		assert.EqualValues(t, 7, p.UserId())
+		assert.EqualValues(t, 3, p.ApiAccount.ID)
+
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set(auth.UserJwtHttpHeader, signUserJwt(t, userClaims()))
+	require.NoError(t, (&HmacSigner{Key: "key", Secret: "secret"}).Sign(req))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,151 @@
+package pkg
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/ratelimit"
+)
+
+const (
+	RateLimitLimitHttpHeader     = "RateLimit-Limit"
+	RateLimitRemainingHttpHeader = "RateLimit-Remaining"
+	RateLimitResetHttpHeader     = "RateLimit-Reset"
+	RateLimitPolicyHttpHeader    = "RateLimit-Policy"
+)
+
+type RateLimitConfig struct {
+	// Limiter defaults to Redis when REDIS_HOST is set and to process memory otherwise.
+	Limiter ratelimit.Limiter
+	// Algorithm of the default Limiter.
+	Algorithm ratelimit.Algorithm
+	// Limit for every client. Zero disables the default limit.
+	Limit ratelimit.Limit
+	// IpLimit is counted by ClientIP in RateLimitIpMiddleware before UserMiddleware and HmacMiddleware,
+	// so requests with invalid tokens or signatures are throttled too. Keep it above Limit when
+	// clients share an IP. Default 10 times Limit.
+	IpLimit ratelimit.Limit
+	// Roles override Limit for API keys by ApiAccount.Role.
+	Roles map[string]ratelimit.Limit
+	// Routes are limits of route templates (c.FullPath()) counted separately from Limit.
+	//
+	//	Routes: map[string]ratelimit.Limit{"/auth/login": ratelimit.PerMinute(10)}
+	Routes map[string]ratelimit.Limit
+	// Key identifies the client. Default RateLimitKey.
+	Key func(c *gin.Context) string
+}
+
+func (config RateLimitConfig) enabled() bool {
+	return !config.Limit.IsZero() || len(config.Roles) > 0 || len(config.Routes) > 0
+}
+
+func (config RateLimitConfig) ipLimit() ratelimit.Limit {
+	if !config.IpLimit.IsZero() || config.Limit.IsZero() {
+		return config.IpLimit
+	}
+	limit := config.Limit
+	limit.Requests *= 10
+	limit.Burst *= 10
+	return limit
+}
+
+// RateLimitKey identifies a client by the Api-Key verified by HmacMiddleware, the user from
+// User-Jwt or ClientIP, in that order.
+func RateLimitKey(c *gin.Context) string {
+	if account, ok := CurrentApiAccount(c); ok {
+		return "key:" + account.Key
+	}
+	if user, ok := CurrentUser(c); ok {
+		return "user:" + strconv.FormatInt(user.ID, 10)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimitMiddleware Ограничивает частоту запросов клиента, при превышении отвечает 429 с Retry-After.
+// Must be used after UserMiddleware and HmacMiddleware to know the client.
+func RateLimitMiddleware(config RateLimitConfig) gin.HandlerFunc {
+	if config.Limiter == nil {
+		config.Limiter = ratelimit.NewMemoryLimiter(config.Algorithm)
+	}
+	if config.Key == nil {
+		config.Key = RateLimitKey
+	}
+
+	return func(c *gin.Context) {
+		key := config.Key(c)
+		limit := config.Limit
+
+		if account, ok := CurrentApiAccount(c); ok {
+			if roleLimit, ok := config.Roles[account.Role]; ok {
+				limit = roleLimit
+			}
+		}
+
+		if routeLimit, ok := config.Routes[c.FullPath()]; ok {
+			limit = routeLimit
+			key += ":" + c.FullPath()
+		}
+
+		if limit.IsZero() {
+			c.Next()
+			return
+		}
+
+		if !allowRequest(c, config.Limiter, key, limit) {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RateLimitIpMiddleware Ограничивает частоту запросов с одного IP лимитом IpLimit, отвечает 429 с Retry-After.
+// Must be used before UserMiddleware and HmacMiddleware: they reject invalid tokens and signatures
+// before RateLimitMiddleware, so brute force of Api-Sign would not be throttled.
+func RateLimitIpMiddleware(config RateLimitConfig) gin.HandlerFunc {
+	if config.Limiter == nil {
+		config.Limiter = ratelimit.NewMemoryLimiter(config.Algorithm)
+	}
+	limit := config.ipLimit()
+
+	return func(c *gin.Context) {
+		// Свой ключ, чтобы анонимные запросы не расходовали квоту RateLimitMiddleware дважды
+		if !limit.IsZero() && !allowRequest(c, config.Limiter, "auth-ip:"+c.ClientIP(), limit) {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// allowRequest takes a request of key from limit, sets RateLimit headers and aborts with 429 above the limit.
+func allowRequest(c *gin.Context, limiter ratelimit.Limiter, key string, limit ratelimit.Limit) bool {
+	result, err := limiter.Allow(c, key, limit)
+	if err != nil {
+		// Недоступность хранилища лимитов не должна останавливать сервис
+		_ = c.Error(fmt.Errorf("rate limit: %w", err))
+		return true
+	}
+
+	header := c.Writer.Header()
+	header.Set(RateLimitLimitHttpHeader, strconv.Itoa(result.Limit))
+	header.Set(RateLimitRemainingHttpHeader, strconv.Itoa(result.Remaining))
+	header.Set(RateLimitResetHttpHeader, seconds(result.Reset))
+	header.Set(RateLimitPolicyHttpHeader, fmt.Sprintf("%d;w=%s", limit.Requests, seconds(limit.Period)))
+
+	if !result.Allowed {
+		header.Set("Retry-After", seconds(result.RetryAfter))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"message": "Too many requests"})
+		return false
+	}
+	return true
+}
+
+// seconds rounds up, so a client never retries too early.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
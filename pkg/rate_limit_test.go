@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/auth"
+	"github.com/iteais/sdk/pkg/models"
+	"github.com/iteais/sdk/pkg/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		switch c.GetHeader("X-Test-Principal") {
+		case "user":
+			setPrincipal(c, &auth.Principal{User: &models.User{ID: 7}})
+		case "service":
+			setPrincipal(c, &auth.Principal{ApiAccount: &models.ApiAccount{Key: "key", Role: "service"}})
+		}
+	}, RateLimitMiddleware(RateLimitConfig{
+		Limit:  ratelimit.PerMinute(2),
+		Roles:  map[string]ratelimit.Limit{"service": ratelimit.PerMinute(5)},
+		Routes: map[string]ratelimit.Limit{"/login": ratelimit.PerMinute(1)},
+	}))
+	router.GET("/events", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.POST("/login", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	call := func(method string, path string, principal string, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set("X-Test-Principal", principal)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call(http.MethodGet, "/events", "", "203.0.113.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get(RateLimitLimitHttpHeader))
+	assert.Equal(t, "1", w.Header().Get(RateLimitRemainingHttpHeader))
+	assert.Equal(t, "2;w=60", w.Header().Get(RateLimitPolicyHttpHeader))
+
+	call(http.MethodGet, "/events", "", "203.0.113.1")
+	w = call(http.MethodGet, "/events", "", "203.0.113.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	// Another IP and the user have their own quota even from the same IP
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/events", "", "203.0.113.2").Code)
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/events", "user", "203.0.113.1").Code)
+
+	// Role quota of API keys
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, call(http.MethodGet, "/events", "service", "203.0.113.1").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, call(http.MethodGet, "/events", "service", "203.0.113.1").Code)
+
+	// Route quota is counted separately
+	assert.Equal(t, http.StatusOK, call(http.MethodPost, "/login", "", "203.0.113.3").Code)
+	assert.Equal(t, http.StatusTooManyRequests, call(http.MethodPost, "/login", "", "203.0.113.3").Code)
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/events", "", "203.0.113.3").Code)
+}
+
+func TestRateLimitIpMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(RateLimitIpMiddleware(RateLimitConfig{Limit: ratelimit.PerMinute(1)}), func(c *gin.Context) {
+		// Подпись не прошла проверку
+		c.AbortWithStatus(http.StatusUnauthorized)
+	})
+	router.GET("/events", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	call := func(ip string) int {
+		req := httptest.NewRequest(http.MethodGet, "/events", nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, http.StatusUnauthorized, call("203.0.113.1"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, call("203.0.113.1"))
+	assert.Equal(t, http.StatusUnauthorized, call("203.0.113.2"))
+}
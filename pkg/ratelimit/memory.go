@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucketState struct {
+	tokens  float64
+	updated time.Time
+	expires time.Time
+}
+
+type windowState struct {
+	index   int64
+	prev    int
+	cur     int
+	expires time.Time
+}
+
+// MemoryLimiter keeps counters in process memory, limits are per replica.
+type MemoryLimiter struct {
+	algorithm Algorithm
+	now       func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucketState
+	windows map[string]*windowState
+	calls   int
+}
+
+func NewMemoryLimiter(algorithm Algorithm) *MemoryLimiter {
+	return &MemoryLimiter{
+		algorithm: algorithm,
+		now:       time.Now,
+		buckets:   make(map[string]*bucketState),
+		windows:   make(map[string]*windowState),
+	}
+}
+
+func (m *MemoryLimiter) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+
+	m.calls++
+	if m.calls%1000 == 0 {
+		m.cleanup(now)
+	}
+
+	if m.algorithm == SlidingWindow {
+		return m.slidingWindow(key, limit, now), nil
+	}
+	return m.tokenBucket(key, limit, now), nil
+}
+
+func (m *MemoryLimiter) tokenBucket(key string, limit Limit, now time.Time) Result {
+	capacity := float64(limit.burst())
+	perNs := float64(limit.Requests) / float64(limit.Period)
+
+	state, ok := m.buckets[key]
+	if !ok {
+		state = &bucketState{tokens: capacity, updated: now}
+		m.buckets[key] = state
+	}
+
+	state.tokens = math.Min(capacity, state.tokens+float64(now.Sub(state.updated))*perNs)
+	state.updated = now
+
+	allowed := state.tokens >= 1
+	if allowed {
+		state.tokens--
+	}
+	state.expires = now.Add(time.Duration((capacity - state.tokens) / perNs))
+
+	return bucketResult(allowed, state.tokens, limit)
+}
+
+func (m *MemoryLimiter) slidingWindow(key string, limit Limit, now time.Time) Result {
+	index := now.UnixNano() / int64(limit.Period)
+	elapsed := time.Duration(now.UnixNano() - index*int64(limit.Period))
+
+	state, ok := m.windows[key]
+	if !ok {
+		state = &windowState{index: index}
+		m.windows[key] = state
+	}
+
+	switch {
+	case state.index == index-1:
+		state.index, state.prev, state.cur = index, state.cur, 0
+	case state.index != index:
+		state.index, state.prev, state.cur = index, 0, 0
+	}
+
+	estimated := float64(state.prev)*float64(limit.Period-elapsed)/float64(limit.Period) + float64(state.cur)
+	allowed := estimated+1 <= float64(limit.Requests)
+	if allowed {
+		state.cur++
+	}
+	state.expires = now.Add(2 * limit.Period)
+
+	return windowResult(allowed, state.prev, state.cur, elapsed, limit)
+}
+
+func (m *MemoryLimiter) cleanup(now time.Time) {
+	for key, state := range m.buckets {
+		if now.After(state.expires) {
+			delete(m.buckets, key)
+		}
+	}
+	for key, state := range m.windows {
+		if now.After(state.expires) {
+			delete(m.windows, key)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestLimiter(algorithm Algorithm) (*MemoryLimiter, *clock) {
+	// Aligned to a minute, so windows start at the test start
+	c := &clock{now: time.Unix(1_700_000_040, 0)}
+	limiter := NewMemoryLimiter(algorithm)
+	limiter.now = c.Now
+	return limiter, c
+}
+
+func TestMemoryLimiter_TokenBucket(t *testing.T) {
+	limiter, clock := newTestLimiter(TokenBucket)
+	ctx := context.Background()
+	limit := Limit{Requests: 10, Period: 10 * time.Second, Burst: 3}
+
+	for i := 2; i >= 0; i-- {
+		result, _ := limiter.Allow(ctx, "key", limit)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+	}
+
+	result, _ := limiter.Allow(ctx, "key", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 3*time.Second, result.Reset)
+
+	// Other keys have their own bucket
+	result, _ = limiter.Allow(ctx, "other", limit)
+	assert.True(t, result.Allowed)
+
+	clock.now = clock.now.Add(time.Second)
+	result, _ = limiter.Allow(ctx, "key", limit)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// The bucket never holds more than Burst
+	clock.now = clock.now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		result, _ = limiter.Allow(ctx, "key", limit)
+		assert.True(t, result.Allowed)
+	}
+	result, _ = limiter.Allow(ctx, "key", limit)
+	assert.False(t, result.Allowed)
+}
+
+func TestMemoryLimiter_SlidingWindow(t *testing.T) {
+	limiter, clock := newTestLimiter(SlidingWindow)
+	ctx := context.Background()
+	limit := PerMinute(4)
+
+	for i := 3; i >= 0; i-- {
+		result, _ := limiter.Allow(ctx, "key", limit)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+	}
+
+	result, _ := limiter.Allow(ctx, "key", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Minute, result.RetryAfter)
+
+	// Half of the next window: 4 * 0.5 requests of the previous window are still counted
+	clock.now = clock.now.Add(90 * time.Second)
+	for i := 0; i < 2; i++ {
+		result, _ = limiter.Allow(ctx, "key", limit)
+		assert.True(t, result.Allowed)
+	}
+	result, _ = limiter.Allow(ctx, "key", limit)
+	assert.False(t, result.Allowed)
+	// 4 * (60 - x) / 60 + 2 + 1 <= 4 after x = 45s
+	assert.Equal(t, 15*time.Second, result.RetryAfter)
+
+	clock.now = clock.now.Add(15 * time.Second)
+	result, _ = limiter.Allow(ctx, "key", limit)
+	assert.True(t, result.Allowed)
+
+	// Windows older than the previous one are forgotten
+	clock.now = clock.now.Add(5 * time.Minute)
+	result, _ = limiter.Allow(ctx, "key", limit)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 3, result.Remaining)
+}
+
+func TestMemoryLimiter_Cleanup(t *testing.T) {
+	limiter, clock := newTestLimiter(TokenBucket)
+
+	_, _ = limiter.Allow(context.Background(), "key", PerSecond(1))
+	clock.now = clock.now.Add(time.Minute)
+	limiter.cleanup(clock.now)
+
+	assert.Empty(t, limiter.buckets)
+}
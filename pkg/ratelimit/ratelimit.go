@@ -0,0 +1,103 @@
+// Package ratelimit limits the rate of requests per key with a token bucket or a sliding window.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+type Algorithm int
+
+const (
+	// TokenBucket allows bursts up to Limit.Burst and refills Limit.Requests tokens per Limit.Period.
+	TokenBucket Algorithm = iota
+	// SlidingWindow allows Limit.Requests in any Limit.Period, estimated from the current and previous windows.
+	SlidingWindow
+)
+
+// Limit allows Requests per Period. Burst is the bucket size of TokenBucket, default Requests.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+func PerSecond(requests int) Limit {
+	return Limit{Requests: requests, Period: time.Second}
+}
+
+func PerMinute(requests int) Limit {
+	return Limit{Requests: requests, Period: time.Minute}
+}
+
+func PerHour(requests int) Limit {
+	return Limit{Requests: requests, Period: time.Hour}
+}
+
+func (l Limit) IsZero() bool {
+	return l.Requests <= 0 || l.Period <= 0
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the quota is restored.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, if it was denied.
+	RetryAfter time.Duration
+}
+
+type Limiter interface {
+	// Allow takes one request of key from limit.
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// bucketResult builds the result of a token bucket with tokens left after the request.
+func bucketResult(allowed bool, tokens float64, limit Limit) Result {
+	perNs := float64(limit.Requests) / float64(limit.Period)
+
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration(math.Ceil((float64(limit.burst()) - tokens) / perNs)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration(math.Ceil((1 - tokens) / perNs))
+	}
+	return result
+}
+
+// windowResult builds the result of a sliding window with request counts of the previous and
+// the current window, elapsed is the time since the current window started.
+func windowResult(allowed bool, prev int, cur int, elapsed time.Duration, limit Limit) Result {
+	period := float64(limit.Period)
+	estimated := float64(prev)*(period-float64(elapsed))/period + float64(cur)
+
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Requests,
+		Remaining: max(0, limit.Requests-int(math.Ceil(estimated))),
+		Reset:     limit.Period - elapsed,
+	}
+
+	if !allowed {
+		if cur+1 > limit.Requests || prev == 0 {
+			result.RetryAfter = limit.Period - elapsed
+		} else {
+			// prev * (period - at) / period + cur + 1 <= requests
+			at := period * (1 - float64(limit.Requests-cur-1)/float64(prev))
+			result.RetryAfter = max(time.Millisecond, time.Duration(math.Ceil(at))-elapsed)
+		}
+	}
+	return result
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript refills the bucket by the Redis clock and takes a token.
+// Tokens are returned as a string, Lua numbers would be truncated to integers.
+var tokenBucketScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = time[1] * 1000 + math.floor(time[2] / 1000)
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2]) / tonumber(ARGV[3])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or capacity
+local updated = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// slidingWindowScript counts requests in fixed windows <key>:<index> and estimates the sliding
+// window from the current and the previous one.
+var slidingWindowScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = time[1] * 1000 + math.floor(time[2] / 1000)
+local period = tonumber(ARGV[1])
+local index = math.floor(now / period)
+local elapsed = now - index * period
+
+local current = KEYS[1] .. ':' .. string.format('%d', index)
+local prev = tonumber(redis.call('GET', KEYS[1] .. ':' .. string.format('%d', index - 1))) or 0
+local cur = tonumber(redis.call('GET', current)) or 0
+
+local allowed = 0
+if prev * (period - elapsed) / period + cur + 1 <= tonumber(ARGV[2]) then
+	cur = redis.call('INCR', current)
+	redis.call('PEXPIRE', current, period * 2)
+	allowed = 1
+end
+return {allowed, prev, cur, elapsed}
+`)
+
+// RedisLimiter keeps counters in Redis so limits are shared between replicas.
+// The Redis clock is used, so clocks of replicas do not matter.
+type RedisLimiter struct {
+	client    *redis.Client
+	prefix    string
+	algorithm Algorithm
+}
+
+func NewRedisLimiter(client *redis.Client, prefix string, algorithm Algorithm) *RedisLimiter {
+	return &RedisLimiter{client: client, prefix: prefix + ":ratelimit:", algorithm: algorithm}
+}
+
+func (r *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if r.algorithm == SlidingWindow {
+		values, err := slidingWindowScript.Run(ctx, r.client, []string{r.prefix + key},
+			limit.Period.Milliseconds(), limit.Requests).Int64Slice()
+		if err != nil {
+			return Result{}, err
+		}
+
+		return windowResult(values[0] == 1, int(values[1]), int(values[2]), time.Duration(values[3])*time.Millisecond, limit), nil
+	}
+
+	values, err := tokenBucketScript.Run(ctx, r.client, []string{r.prefix + key},
+		limit.burst(), limit.Requests, limit.Period.Milliseconds()).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	allowed, _ := values[0].(int64)
+	tokens, _ := strconv.ParseFloat(values[1].(string), 64)
+
+	return bucketResult(allowed == 1, tokens, limit), nil
+}
@@ -0,0 +1,257 @@
+// Package redact masks personal data and credentials before they are logged or sent to Sentry.
+//
+// Values are masked by field name (JSON keys and form fields), by header name and by regexes
+// applied to any text. Field names are collected from `sdk:"pii"` tags with Register:
+//
+//	type Member struct {
+//		Phone string `json:"phone" sdk:"pii"`
+//	}
+//
+//	redact.Default.Register(Member{})
+package redact
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/iteais/sdk/pkg/models"
+)
+
+const (
+	Mask = "[REDACTED]"
+	// Tag is the struct tag of fields with personal data, e.g. `sdk:"pii"`.
+	Tag = "sdk"
+)
+
+var (
+	EmailPattern  = regexp.MustCompile(`[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}`)
+	JwtPattern    = regexp.MustCompile(`eyJ[a-zA-Z0-9_\-]+\.[a-zA-Z0-9_\-]+\.[a-zA-Z0-9_\-]*`)
+	BearerPattern = regexp.MustCompile(`(?i)bearer\s+[a-zA-Z0-9._~+/\-]+=*`)
+
+	// Строковые литералы с учетом экранирования '' внутри
+	sqlStringLiteral = regexp.MustCompile(`'(?:[^']|'')*'`)
+)
+
+// Query replaces string literals of an SQL query with '?', numbers and identifiers are kept.
+// It is used for the SQL query log and the query text of tracing spans.
+func Query(query string) string {
+	return sqlStringLiteral.ReplaceAllLiteralString(query, "'?'")
+}
+
+// Default is used by HttpLogger, the SQL query log and Sentry events.
+var Default = New(Config{})
+
+func init() {
+	Default.Register(models.User{})
+}
+
+type Config struct {
+	// Fields are added to password, token, secret and similar names. Case, "_" and "-" are ignored.
+	Fields []string
+	// Headers are added to Authorization, Cookie, User-Jwt, Api-Sign and similar headers.
+	Headers []string
+	// Patterns are added to EmailPattern, JwtPattern and BearerPattern.
+	Patterns []*regexp.Regexp
+}
+
+type Redactor struct {
+	mu       sync.RWMutex
+	fields   map[string]struct{}
+	headers  map[string]struct{}
+	patterns []*regexp.Regexp
+}
+
+func New(config Config) *Redactor {
+	r := &Redactor{
+		fields:  map[string]struct{}{},
+		headers: map[string]struct{}{},
+	}
+	r.AddFields("password", "passwd", "secret", "token", "access_token", "refresh_token", "api_secret", "authorization")
+	r.AddFields(config.Fields...)
+	r.AddHeaders("Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "User-Jwt", "Api-Sign", "Api-Nonce")
+	r.AddHeaders(config.Headers...)
+	r.AddPatterns(EmailPattern, JwtPattern, BearerPattern)
+	r.AddPatterns(config.Patterns...)
+	return r
+}
+
+func (r *Redactor) AddFields(names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range names {
+		r.fields[normalize(name)] = struct{}{}
+	}
+}
+
+func (r *Redactor) AddHeaders(names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range names {
+		r.headers[http.CanonicalHeaderKey(name)] = struct{}{}
+	}
+}
+
+func (r *Redactor) AddPatterns(patterns ...*regexp.Regexp) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patterns = append(r.patterns, patterns...)
+}
+
+// Register adds JSON names of fields tagged `sdk:"pii"`, nested and embedded structs included.
+func (r *Redactor) Register(models ...any) {
+	for _, model := range models {
+		r.register(reflect.TypeOf(model), map[reflect.Type]bool{})
+	}
+}
+
+func (r *Redactor) register(t reflect.Type, seen map[reflect.Type]bool) {
+	for t != nil && (t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || seen[t] {
+		return
+	}
+	seen[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if hasPiiTag(field.Tag.Get(Tag)) {
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				name = field.Name
+			}
+			r.AddFields(name)
+		}
+		r.register(field.Type, seen)
+	}
+}
+
+func hasPiiTag(tag string) bool {
+	for _, option := range strings.Split(tag, ",") {
+		if strings.TrimSpace(option) == "pii" {
+			return true
+		}
+	}
+	return false
+}
+
+// IsField reports whether values of the field must be masked.
+func (r *Redactor) IsField(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.fields[normalize(name)]
+	return ok
+}
+
+// IsHeader reports whether the header must be masked.
+func (r *Redactor) IsHeader(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.headers[http.CanonicalHeaderKey(name)]
+	return ok
+}
+
+// String masks matches of the patterns.
+func (r *Redactor) String(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, pattern := range r.patterns {
+		s = pattern.ReplaceAllLiteralString(s, Mask)
+	}
+	return s
+}
+
+// Headers returns a copy of h with masked values.
+func (r *Redactor) Headers(h http.Header) map[string]string {
+	result := make(map[string]string, len(h))
+	for name, values := range h {
+		if r.IsHeader(name) {
+			result[name] = Mask
+			continue
+		}
+		result[name] = r.String(strings.Join(values, ","))
+	}
+	return result
+}
+
+// HeaderMap is Headers for map[string]string, e.g. headers of Sentry events.
+func (r *Redactor) HeaderMap(h map[string]string) map[string]string {
+	result := make(map[string]string, len(h))
+	for name, value := range h {
+		if r.IsHeader(name) {
+			result[name] = Mask
+			continue
+		}
+		result[name] = r.String(value)
+	}
+	return result
+}
+
+// Body masks a JSON or url-encoded form body, other content is masked by the patterns only.
+func (r *Redactor) Body(body []byte, contentType string) string {
+	switch {
+	case strings.Contains(contentType, "json"):
+		var value any
+		if err := json.Unmarshal(body, &value); err == nil {
+			if masked, err := json.Marshal(r.Value(value)); err == nil {
+				return string(masked)
+			}
+		}
+	case strings.Contains(contentType, "x-www-form-urlencoded"):
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			return r.Query(values)
+		}
+	}
+	return r.String(string(body))
+}
+
+// Query masks url.Values of a query string or a form.
+func (r *Redactor) Query(values url.Values) string {
+	masked := make(url.Values, len(values))
+	for name, list := range values {
+		for _, value := range list {
+			if r.IsField(name) {
+				value = Mask
+			} else {
+				value = r.String(value)
+			}
+			masked.Add(name, value)
+		}
+	}
+	return masked.Encode()
+}
+
+// Value masks decoded JSON: values of registered fields and pattern matches in strings.
+func (r *Redactor) Value(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			if r.IsField(key) {
+				result[key] = Mask
+				continue
+			}
+			result[key] = r.Value(item)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = r.Value(item)
+		}
+		return result
+	case string:
+		return r.String(v)
+	default:
+		return v
+	}
+}
+
+func normalize(name string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(name))
+}
@@ -0,0 +1,66 @@
+package redact
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type member struct {
+	Id      int64  `json:"id"`
+	Phone   string `json:"phone" sdk:"pii"`
+	Profile struct {
+		Passport string `json:"passport_number" sdk:"pii,omitempty"`
+	} `json:"profile"`
+}
+
+func TestRedactor_Body(t *testing.T) {
+	r := New(Config{Patterns: []*regexp.Regexp{regexp.MustCompile(`\+7\d{10}`)}})
+	r.Register(member{})
+
+	body := `{"id":1,"phone":"+79990001122","profile":{"passport_number":"4510 123456"},"note":"call +79990001122 or john@example.com","Password":"123"}`
+	assert.JSONEq(t,
+		`{"id":1,"phone":"[REDACTED]","profile":{"passport_number":"[REDACTED]"},"note":"call [REDACTED] or [REDACTED]","Password":"[REDACTED]"}`,
+		r.Body([]byte(body), "application/json; charset=utf-8"))
+
+	assert.Equal(t, "email=%5BREDACTED%5D&password=%5BREDACTED%5D&title=Go",
+		r.Body([]byte("email=john%40example.com&password=123&title=Go"), "application/x-www-form-urlencoded"))
+
+	// Not JSON despite the content type
+	assert.Equal(t, "token [REDACTED]", r.Body([]byte("token Bearer abc.def"), "application/json"))
+}
+
+func TestRedactor_Headers(t *testing.T) {
+	r := New(Config{Headers: []string{"x-internal-key"}})
+
+	headers := r.Headers(http.Header{
+		"User-Jwt":       {"eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.sig"},
+		"Api-Sign":       {"signature"},
+		"X-Internal-Key": {"key"},
+		"Referer":        {"https://example.com/?token=eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.sig"},
+		"Accept":         {"application/json"},
+	})
+
+	assert.Equal(t, map[string]string{
+		"User-Jwt":       Mask,
+		"Api-Sign":       Mask,
+		"X-Internal-Key": Mask,
+		"Referer":        "https://example.com/?token=" + Mask,
+		"Accept":         "application/json",
+	}, headers)
+}
+
+func TestDefault_User(t *testing.T) {
+	assert.True(t, Default.IsField("email"))
+	assert.True(t, Default.IsField("first_name"))
+	assert.False(t, Default.IsField("id"))
+	assert.Equal(t, "page=2&token=%5BREDACTED%5D", Default.Query(url.Values{"token": {"abc"}, "page": {"2"}}))
+}
+
+func TestQuery(t *testing.T) {
+	assert.Equal(t, `UPDATE "sdk_refresh_tokens" SET used_at = '?' WHERE hash = '?' AND user_id = 7`,
+		Query(`UPDATE "sdk_refresh_tokens" SET used_at = '2026-01-01' WHERE hash = 'ab''cd' AND user_id = 7`))
+}
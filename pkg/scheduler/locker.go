@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/uptrace/bun"
+)
+
+// Locker guarantees that a tick of a task is executed by a single replica.
+type Locker interface {
+	// TryLock returns ok == false without error when the lock is held by another replica.
+	// release must be called after the task finishes.
+	TryLock(ctx context.Context, key string, ttl time.Duration) (release func(), ok bool, err error)
+}
+
+// RedisLocker takes a SET NX key per tick which expires with ttl. The key is not deleted
+// on release so that a replica with a late clock cannot run the same tick again.
+type RedisLocker struct {
+	client *redis.Client
+}
+
+func NewRedisLocker(client *redis.Client) *RedisLocker {
+	return &RedisLocker{client: client}
+}
+
+func (l *RedisLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	ok, err := l.client.SetNX(ctx, key, 1, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return func() {}, true, nil
+}
+
+type scheduleRun struct {
+	bun.BaseModel `bun:"table:sdk_schedule_runs"`
+
+	Key       string    `bun:",pk"`
+	ExpiresAt time.Time `bun:",notnull"`
+}
+
+// PgLocker inserts a row per tick into the sdk_schedule_runs table, created on first use.
+// Like RedisLocker the row is kept until ttl expires, so a replica which reaches the same tick
+// after the task finished does not run it again.
+type PgLocker struct {
+	db     *bun.DB
+	initMu sync.Mutex
+	inited bool
+}
+
+func NewPgLocker(db *bun.DB) *PgLocker {
+	return &PgLocker{db: db}
+}
+
+func (l *PgLocker) init(ctx context.Context) error {
+	l.initMu.Lock()
+	defer l.initMu.Unlock()
+	if l.inited {
+		return nil
+	}
+
+	if _, err := l.db.NewCreateTable().Model((*scheduleRun)(nil)).IfNotExists().Exec(context.WithoutCancel(ctx)); err != nil {
+		return err
+	}
+	l.inited = true
+	return nil
+}
+
+func (l *PgLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	if err := l.init(ctx); err != nil {
+		return nil, false, err
+	}
+
+	now := time.Now()
+	res, err := l.db.NewInsert().Model(&scheduleRun{Key: key, ExpiresAt: now.Add(ttl)}).
+		On("CONFLICT (key) DO NOTHING").Exec(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, false, err
+	}
+
+	// Ключи тиков не повторяются, старые строки только занимают место
+	_, _ = l.db.NewDelete().Model((*scheduleRun)(nil)).Where("expires_at < ?", now).Exec(ctx)
+
+	return func() {}, true, nil
+}
+
+// localLocker always succeeds. It is used when the scheduler runs in a single process.
+type localLocker struct{}
+
+func (localLocker) TryLock(context.Context, string, time.Duration) (func(), bool, error) {
+	return func() {}, true, nil
+}
@@ -0,0 +1,24 @@
+package scheduler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	runsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_runs_total",
+		Help: "Number of scheduled task ticks by result (success, error, skipped).",
+	}, []string{"task", "result"})
+
+	runDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scheduler_duration_seconds",
+		Help:    "Scheduled task duration.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"task"})
+
+	lastRun = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scheduler_last_run_timestamp_seconds",
+		Help: "Unix time of the last run of a scheduled task on this replica.",
+	}, []string{"task"})
+)
@@ -0,0 +1,239 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+)
+
+// TaskFunc is the body of a scheduled task. ctx is cancelled on shutdown.
+type TaskFunc func(ctx context.Context) error
+
+// TaskStatus describes the last execution of a task on this replica.
+type TaskStatus struct {
+	Name         string    `json:"name"`
+	Spec         string    `json:"spec"`
+	NextRun      time.Time `json:"next_run"`
+	LastRun      time.Time `json:"last_run,omitempty"`
+	LastDuration string    `json:"last_duration,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+	Runs         int       `json:"runs"`
+	Skipped      int       `json:"skipped"`
+}
+
+type task struct {
+	spec     string
+	schedule cron.Schedule
+	fn       TaskFunc
+	status   TaskStatus
+}
+
+// Scheduler runs tasks by cron expressions inside the service process.
+type Scheduler struct {
+	locker Locker
+	prefix string
+	logger logrus.FieldLogger
+
+	mu      sync.RWMutex
+	tasks   map[string]*task
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running bool
+}
+
+// New creates a scheduler. Lock keys are prefixed with prefix so that several services can share
+// the same Redis or Postgres. A nil locker runs every tick on every replica.
+func New(locker Locker, prefix string, logger logrus.FieldLogger) *Scheduler {
+	if locker == nil {
+		locker = localLocker{}
+	}
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+
+	return &Scheduler{
+		locker: locker,
+		prefix: prefix,
+		logger: logger,
+		tasks:  make(map[string]*task),
+	}
+}
+
+// Add registers a task with a standard 5 field cron spec ("*/5 * * * *") or a descriptor
+// such as "@hourly" or "@every 30s". Tasks added after Start are started immediately.
+func (s *Scheduler) Add(spec string, name string, fn TaskFunc) error {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return fmt.Errorf("scheduler: task %s: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tasks[name]; ok {
+		return fmt.Errorf("scheduler: task %s is already registered", name)
+	}
+
+	t := &task{
+		spec:     spec,
+		schedule: schedule,
+		fn:       fn,
+		status:   TaskStatus{Name: name, Spec: spec},
+	}
+	s.tasks[name] = t
+
+	if s.running {
+		s.startTask(s.ctx, name, t)
+	}
+
+	return nil
+}
+
+// Start launches a goroutine per task.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.running = true
+
+	for name, t := range s.tasks {
+		s.startTask(s.ctx, name, t)
+	}
+}
+
+// Stop cancels pending ticks and waits for running tasks until ctx expires.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return nil
+	}
+	s.running = false
+	s.cancel()
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status returns the state of all tasks sorted by name.
+func (s *Scheduler) Status() []TaskStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]TaskStatus, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		status := t.status
+		status.NextRun = t.schedule.Next(time.Now())
+		result = append(result, status)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+func (s *Scheduler) startTask(ctx context.Context, name string, t *task) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		for {
+			next := t.schedule.Next(time.Now())
+			timer := time.NewTimer(time.Until(next))
+
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			s.tick(ctx, name, t, next)
+		}
+	}()
+}
+
+func (s *Scheduler) tick(ctx context.Context, name string, t *task, at time.Time) {
+	logger := s.logger.WithField("task", name)
+
+	// The lock lives until the next tick so that a replica with a slow clock cannot repeat it.
+	ttl := time.Until(t.schedule.Next(at))
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+
+	key := s.prefix + ":schedule:" + name + ":" + strconv.FormatInt(at.Unix(), 10)
+	release, ok, err := s.locker.TryLock(ctx, key, ttl)
+	if err != nil {
+		logger.WithError(err).Error("scheduler: lock failed")
+	}
+	if !ok {
+		runsTotal.WithLabelValues(name, "skipped").Inc()
+		s.mu.Lock()
+		t.status.Skipped++
+		s.mu.Unlock()
+		return
+	}
+	defer release()
+
+	start := time.Now()
+	err = s.call(ctx, t.fn)
+	elapsed := time.Since(start)
+
+	runDuration.WithLabelValues(name).Observe(elapsed.Seconds())
+	lastRun.WithLabelValues(name).Set(float64(start.Unix()))
+
+	s.mu.Lock()
+	t.status.LastRun = start
+	t.status.LastDuration = elapsed.String()
+	t.status.Runs++
+	t.status.LastError = ""
+	if err != nil {
+		t.status.LastError = err.Error()
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		runsTotal.WithLabelValues(name, "error").Inc()
+		logger.WithError(err).Error("scheduler: task failed")
+		return
+	}
+
+	runsTotal.WithLabelValues(name, "success").Inc()
+	logger.Infof("scheduler: task finished in %s", elapsed)
+}
+
+func (s *Scheduler) call(ctx context.Context, fn TaskFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return fn(ctx)
+}
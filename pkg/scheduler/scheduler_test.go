@@ -0,0 +1,91 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+type denyLocker struct{}
+
+func (denyLocker) TryLock(context.Context, string, time.Duration) (func(), bool, error) {
+	return nil, false, nil
+}
+
+func TestScheduler_Add(t *testing.T) {
+	s := New(nil, "test", nil)
+
+	assert.NoError(t, s.Add("*/5 * * * *", "cleanup", func(context.Context) error { return nil }))
+	assert.Error(t, s.Add("*/5 * * * *", "cleanup", func(context.Context) error { return nil }))
+	assert.Error(t, s.Add("not a spec", "invalid", func(context.Context) error { return nil }))
+
+	status := s.Status()
+	assert.Len(t, status, 1)
+	assert.Equal(t, "cleanup", status[0].Name)
+	assert.True(t, status[0].NextRun.After(time.Now()))
+}
+
+func TestScheduler_RunsAndRecordsStatus(t *testing.T) {
+	s := New(nil, "test", nil)
+	_ = s.Add("@every 1s", "fail", func(context.Context) error { return errors.New("boom") })
+
+	s.Start()
+	assert.Eventually(t, func() bool {
+		return s.Status()[0].Runs > 0
+	}, 3*time.Second, 20*time.Millisecond)
+	assert.NoError(t, s.Stop(context.Background()))
+
+	status := s.Status()[0]
+	assert.Equal(t, "boom", status.LastError)
+	assert.False(t, status.LastRun.IsZero())
+}
+
+func TestScheduler_SkipsWhenLocked(t *testing.T) {
+	s := New(denyLocker{}, "test", nil)
+	called := false
+	_ = s.Add("@every 1s", "locked", func(context.Context) error {
+		called = true
+		return nil
+	})
+
+	s.Start()
+	assert.Eventually(t, func() bool {
+		return s.Status()[0].Skipped > 0
+	}, 3*time.Second, 20*time.Millisecond)
+	assert.NoError(t, s.Stop(context.Background()))
+
+	assert.False(t, called)
+}
+
+func TestPgLocker_RunsTickOnce(t *testing.T) {
+	sqldb, err := sql.Open(sqliteshim.ShimName, "file::memory:")
+	require.NoError(t, err)
+	sqldb.SetMaxOpenConns(1)
+	db := bun.NewDB(sqldb, sqlitedialect.New())
+	defer db.Close()
+
+	locker := NewPgLocker(db)
+	ctx := context.Background()
+
+	release, ok, err := locker.TryLock(ctx, "test:schedule:cleanup:60", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	release()
+
+	// Тик уже выполнен, повторный запуск после release запрещен
+	_, ok, err = locker.TryLock(ctx, "test:schedule:cleanup:60", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, ok, err = locker.TryLock(ctx, "test:schedule:cleanup:120", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
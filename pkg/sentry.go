@@ -0,0 +1,231 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/redact"
+	log "github.com/sirupsen/logrus"
+	"github.com/uptrace/bun"
+)
+
+var hasSentry bool
+
+// initSentry fills options from env: SENTRY_SERVER and ENVIRONMENT, in DEV with debug and 50% of transactions.
+// Sentry is disabled without Dsn or with a malformed one, the service starts anyway.
+func initSentry(options sentry.ClientOptions, appName string) bool {
+	if options.Dsn == "" {
+		options.Dsn = os.Getenv("SENTRY_SERVER")
+	}
+	if options.Dsn == "" {
+		return false
+	}
+
+	isDev := os.Getenv("ENVIRONMENT") == "DEV"
+	if options.Environment == "" {
+		options.Environment = os.Getenv("ENVIRONMENT")
+	}
+	options.Debug = options.Debug || isDev
+	if !options.EnableTracing && options.TracesSampleRate == 0 && options.TracesSampler == nil {
+		options.EnableTracing = true
+		options.TracesSampleRate = 1.0
+		if isDev {
+			options.TracesSampleRate = 0.5
+		}
+	}
+
+	beforeSend := options.BeforeSend
+	options.BeforeSend = func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+		event = redactSentryEvent(event)
+		if beforeSend != nil {
+			return beforeSend(event, hint)
+		}
+		return event
+	}
+	beforeSendTransaction := options.BeforeSendTransaction
+	options.BeforeSendTransaction = func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+		event = redactSentryEvent(event)
+		if beforeSendTransaction != nil {
+			return beforeSendTransaction(event, hint)
+		}
+		return event
+	}
+
+	if err := sentry.Init(options); err != nil {
+		log.WithError(err).Error("sentry is disabled, the DSN (SENTRY_SERVER) is malformed")
+		return false
+	}
+
+	sentry.ConfigureScope(func(scope *sentry.Scope) {
+		scope.SetExtra("application", appName)
+	})
+
+	return true
+}
+
+// SentryMiddleware gives every request its own hub and transaction, captures panics and 5xx responses.
+// It must go after gin.Recovery: panics are reported and re-panicked, Recovery writes the 500 response.
+func SentryMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = UnmatchedRoute
+		}
+
+		hub := sentry.CurrentHub().Clone()
+		ctx := sentry.SetHubOnContext(c.Request.Context(), hub)
+
+		transaction := sentry.StartTransaction(ctx, c.Request.Method+" "+route,
+			sentry.ContinueTrace(hub, c.GetHeader(sentry.SentryTraceHeader), c.GetHeader(sentry.SentryBaggageHeader)),
+			sentry.WithOpName("http.server"),
+			sentry.WithTransactionSource(sentry.SourceRoute),
+			sentry.WithSpanOrigin(sentry.SpanOriginGin),
+		)
+		transaction.SetData("http.request.method", c.Request.Method)
+
+		hub.Scope().SetRequest(sentryRequest(c.Request))
+		hub.Scope().SetTag("route", route)
+		if traceId := c.GetString(TraceIdContextKey); traceId != "" {
+			hub.Scope().SetTag("trace_id", traceId)
+		}
+
+		c.Request = c.Request.WithContext(transaction.Context())
+
+		defer func() {
+			// Пользователь известен только после UserMiddleware
+			if user, ok := CurrentUser(c); ok {
+				hub.Scope().SetUser(sentry.User{ID: strconv.FormatInt(user.ID, 10)})
+			}
+
+			if err := recover(); err != nil {
+				hub.RecoverWithContext(c.Request.Context(), err)
+				transaction.Status = sentry.SpanStatusInternalError
+				transaction.SetData("http.response.status_code", http.StatusInternalServerError)
+				transaction.Finish()
+				panic(err)
+			}
+
+			status := c.Writer.Status()
+			transaction.Status = sentry.HTTPtoSpanStatus(status)
+			transaction.SetData("http.response.status_code", status)
+			transaction.Finish()
+
+			if status < http.StatusInternalServerError {
+				return
+			}
+			if len(c.Errors) == 0 {
+				hub.CaptureMessage(fmt.Sprintf("%s %s responded %d", c.Request.Method, route, status))
+				return
+			}
+			for _, e := range c.Errors {
+				hub.CaptureException(e.Err)
+			}
+		}()
+
+		c.Next()
+	}
+}
+
+// sentryRequest is a copy of r without a body and credentials.
+func sentryRequest(r *http.Request) *http.Request {
+	clone := r.Clone(r.Context())
+	clone.Body = http.NoBody
+	for name := range clone.Header {
+		if redact.Default.IsHeader(name) {
+			clone.Header.Del(name)
+		}
+	}
+	return clone
+}
+
+// redactSentryEvent masks personal data in the request, messages and breadcrumbs with redact.Default.
+func redactSentryEvent(event *sentry.Event) *sentry.Event {
+	if event == nil {
+		return nil
+	}
+
+	r := redact.Default
+	event.Message = r.String(event.Message)
+	for i := range event.Exception {
+		event.Exception[i].Value = r.String(event.Exception[i].Value)
+	}
+	for _, breadcrumb := range event.Breadcrumbs {
+		breadcrumb.Message = r.String(breadcrumb.Message)
+	}
+
+	if request := event.Request; request != nil {
+		request.URL = r.String(request.URL)
+		request.Headers = r.HeaderMap(request.Headers)
+		if request.Cookies != "" {
+			request.Cookies = redact.Mask
+		}
+		if values, err := url.ParseQuery(request.QueryString); err == nil {
+			request.QueryString = r.Query(values)
+		}
+		if request.Data != "" {
+			request.Data = r.Body([]byte(request.Data), request.Headers["Content-Type"])
+		}
+	}
+
+	return event
+}
+
+type sentrySpanKey struct{}
+
+// sentryQueryHook adds a span for every bun query to the Sentry transaction of the request.
+type sentryQueryHook struct{}
+
+var _ bun.QueryHook = sentryQueryHook{}
+
+func (sentryQueryHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	if sentry.SpanFromContext(ctx) == nil {
+		return ctx
+	}
+	span := sentry.StartSpan(ctx, "db.sql.query", sentry.WithDescription(event.Operation()))
+	span.StartTime = event.StartTime
+	span.SetData("db.system", "postgresql")
+	return context.WithValue(span.Context(), sentrySpanKey{}, span)
+}
+
+func (sentryQueryHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	span, ok := ctx.Value(sentrySpanKey{}).(*sentry.Span)
+	if !ok {
+		return
+	}
+	span.Status = sentry.SpanStatusOK
+	if event.Err != nil && !errors.Is(event.Err, sql.ErrNoRows) {
+		span.Status = sentry.SpanStatusInternalError
+	}
+	span.Finish()
+}
+
+// sentryTransport adds a span for every request to the Sentry transaction of the request.
+type sentryTransport struct {
+	base http.RoundTripper
+}
+
+func (t sentryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if sentry.SpanFromContext(req.Context()) == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	span := sentry.StartSpan(req.Context(), "http.client", sentry.WithDescription(req.Method+" "+req.URL.Redacted()))
+	defer span.Finish()
+
+	resp, err := t.base.RoundTrip(req.WithContext(span.Context()))
+	if err != nil {
+		span.Status = sentry.SpanStatusInternalError
+		return nil, err
+	}
+	span.Status = sentry.HTTPtoSpanStatus(resp.StatusCode)
+	span.SetData("http.response.status_code", resp.StatusCode)
+	return resp, nil
+}
@@ -0,0 +1,111 @@
+package pkg
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/auth"
+	"github.com/iteais/sdk/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSentryMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	transport := &sentry.MockTransport{}
+	require.True(t, initSentry(sentry.ClientOptions{Dsn: "https://key@sentry.example.com/1", Transport: transport}, "test"))
+	defer sentry.CurrentHub().BindClient(nil)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(TraceIdContextKey, "trace-1")
+		setPrincipal(c, &auth.Principal{User: &models.User{ID: 7, Email: "john@example.com"}})
+	}, gin.Recovery(), SentryMiddleware())
+	router.GET("/ok", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET("/panic/:id", func(c *gin.Context) {
+		panic("boom")
+	})
+	router.GET("/error", func(c *gin.Context) {
+		_ = c.Error(errors.New("db is down"))
+		c.Status(http.StatusInternalServerError)
+	})
+
+	call := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(auth.UserJwtHttpHeader, "token")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	errorEvents := func() []*sentry.Event {
+		var events []*sentry.Event
+		for _, event := range transport.Events() {
+			if event.Type != "transaction" {
+				events = append(events, event)
+			}
+		}
+		return events
+	}
+
+	assert.Equal(t, http.StatusOK, call("/ok").Code)
+	assert.Empty(t, errorEvents())
+
+	assert.Equal(t, http.StatusInternalServerError, call("/panic/1").Code)
+	events := errorEvents()
+	require.Len(t, events, 1)
+	assert.Equal(t, "boom", events[0].Message)
+	assert.Equal(t, "/panic/:id", events[0].Tags["route"])
+	assert.Equal(t, "trace-1", events[0].Tags["trace_id"])
+	assert.Equal(t, "7", events[0].User.ID)
+	assert.Empty(t, events[0].User.Email)
+	assert.NotContains(t, events[0].Request.Headers, auth.UserJwtHttpHeader)
+
+	assert.Equal(t, http.StatusInternalServerError, call("/error").Code)
+	events = errorEvents()
+	require.Len(t, events, 2)
+	require.NotEmpty(t, events[1].Exception)
+	assert.Equal(t, "db is down", events[1].Exception[0].Value)
+
+	var transactions []string
+	for _, event := range transport.Events() {
+		if event.Type == "transaction" {
+			transactions = append(transactions, event.Transaction)
+		}
+	}
+	assert.Equal(t, []string{"GET /ok", "GET /panic/:id", "GET /error"}, transactions)
+}
+
+func TestInitSentry_Disabled(t *testing.T) {
+	t.Setenv("SENTRY_SERVER", "")
+	assert.False(t, initSentry(sentry.ClientOptions{}, "test"))
+
+	t.Setenv("SENTRY_SERVER", "not a dsn")
+	assert.False(t, initSentry(sentry.ClientOptions{}, "test"))
+}
+
+func TestRedactSentryEvent(t *testing.T) {
+	event := redactSentryEvent(&sentry.Event{
+		Message:   "user john@example.com not found",
+		Exception: []sentry.Exception{{Value: "duplicate key email=(john@example.com)"}},
+		Request: &sentry.Request{
+			URL:         "https://example.com/user",
+			QueryString: "email=john%40example.com&page=2",
+			Headers:     map[string]string{"User-Jwt": "token", "Content-Type": "application/json"},
+			Data:        `{"password":"secret","title":"Go"}`,
+		},
+	})
+
+	assert.Equal(t, "user [REDACTED] not found", event.Message)
+	assert.Equal(t, "duplicate key email=([REDACTED])", event.Exception[0].Value)
+	assert.Equal(t, "email=%5BREDACTED%5D&page=2", event.Request.QueryString)
+	assert.Equal(t, "[REDACTED]", event.Request.Headers["User-Jwt"])
+	assert.JSONEq(t, `{"password":"[REDACTED]","title":"Go"}`, event.Request.Data)
+}
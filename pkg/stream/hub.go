@@ -0,0 +1,249 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Event is a message delivered to subscribers of a topic.
+type Event struct {
+	ID    string          `json:"id"`
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+	Time  time.Time       `json:"time"`
+	// Restriction is set by PublishRestricted, it is not sent to clients.
+	Restriction *Restriction `json:"restriction,omitempty"`
+}
+
+// Restriction limits delivery of an event to subscribers accepted by the filter of HandlerWithFilter,
+// e.g. owners of a model readable only with "event.read:own".
+type Restriction struct {
+	Permission string `json:"permission"`
+	OwnerId    int64  `json:"owner_id,omitempty"`
+}
+
+// Broker distributes events between replicas.
+type Broker interface {
+	Publish(ctx context.Context, event Event) error
+	// Subscribe calls handler for every event published by any replica until ctx is done.
+	Subscribe(ctx context.Context, handler func(Event)) error
+}
+
+type Config struct {
+	// History is how many events per topic are kept for Last-Event-ID resume. Default 100.
+	History int
+	// Heartbeat is the interval of keep-alive comments sent to idle clients. Default 15s.
+	Heartbeat time.Duration
+	// Buffer is the per subscriber queue length. Slow subscribers are disconnected. Default 64.
+	Buffer int
+}
+
+// Hub fans out events to subscribers by topic.
+type Hub struct {
+	config Config
+	broker Broker
+	logger logrus.FieldLogger
+	node   string
+	seq    atomic.Int64
+
+	mu      sync.RWMutex
+	subs    map[string]map[*Subscription]struct{}
+	history map[string][]Event
+}
+
+// NewHub creates a hub. With a nil broker events are only delivered within the process.
+func NewHub(broker Broker, config Config, logger logrus.FieldLogger) *Hub {
+	if config.History <= 0 {
+		config.History = 100
+	}
+	if config.Heartbeat <= 0 {
+		config.Heartbeat = 15 * time.Second
+	}
+	if config.Buffer <= 0 {
+		config.Buffer = 64
+	}
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+
+	return &Hub{
+		config:  config,
+		broker:  broker,
+		logger:  logger,
+		node:    uuid.New().String()[:8],
+		subs:    make(map[string]map[*Subscription]struct{}),
+		history: make(map[string][]Event),
+	}
+}
+
+// Start listens to the broker until ctx is done. It is a no-op without a broker.
+func (h *Hub) Start(ctx context.Context) {
+	if h.broker == nil {
+		return
+	}
+
+	go func() {
+		for ctx.Err() == nil {
+			if err := h.broker.Subscribe(ctx, h.dispatch); err != nil && ctx.Err() == nil {
+				h.logger.WithError(err).Error("stream: broker subscription failed")
+				time.Sleep(time.Second)
+			}
+		}
+	}()
+}
+
+// Publish sends data encoded as JSON to all subscribers of topic on all replicas.
+func (h *Hub) Publish(ctx context.Context, topic string, eventType string, data any) error {
+	return h.publish(ctx, topic, eventType, data, nil)
+}
+
+// PublishRestricted is Publish for events which only some subscribers may see, see HandlerWithFilter.
+func (h *Hub) PublishRestricted(ctx context.Context, topic string, eventType string, data any, restriction Restriction) error {
+	return h.publish(ctx, topic, eventType, data, &restriction)
+}
+
+func (h *Hub) publish(ctx context.Context, topic string, eventType string, data any, restriction *Restriction) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	event := Event{
+		ID:    h.node + "-" + strconv.FormatInt(h.seq.Add(1), 10),
+		Topic: topic,
+		Type:  eventType,
+		Data:  raw,
+		Time:  time.Now(),
+
+		Restriction: restriction,
+	}
+
+	if h.broker == nil {
+		h.dispatch(event)
+		return nil
+	}
+
+	return h.broker.Publish(ctx, event)
+}
+
+// Subscribe registers a subscription for topics. If lastEventId is found in the history of a
+// topic, events published after it are returned to be replayed before live events.
+func (h *Hub) Subscribe(topics []string, lastEventId string) (*Subscription, []Event) {
+	sub := &Subscription{
+		hub:    h,
+		topics: topics,
+		events: make(chan Event, h.config.Buffer),
+		closed: make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var replay []Event
+	for _, topic := range topics {
+		if h.subs[topic] == nil {
+			h.subs[topic] = make(map[*Subscription]struct{})
+		}
+		h.subs[topic][sub] = struct{}{}
+
+		if lastEventId == "" {
+			continue
+		}
+
+		history := h.history[topic]
+		for i := range history {
+			if history[i].ID == lastEventId {
+				replay = append(replay, history[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return sub, replay
+}
+
+// Close disconnects all subscribers, e.g. so that open SSE responses do not block server shutdown.
+func (h *Hub) Close() {
+	h.mu.RLock()
+	subs := make([]*Subscription, 0)
+	for _, topicSubs := range h.subs {
+		for sub := range topicSubs {
+			subs = append(subs, sub)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, sub := range subs {
+		sub.Close()
+	}
+}
+
+func (h *Hub) unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, topic := range sub.topics {
+		delete(h.subs[topic], sub)
+		if len(h.subs[topic]) == 0 {
+			delete(h.subs, topic)
+		}
+	}
+}
+
+func (h *Hub) dispatch(event Event) {
+	h.mu.Lock()
+	history := append(h.history[event.Topic], event)
+	if len(history) > h.config.History {
+		history = history[len(history)-h.config.History:]
+	}
+	h.history[event.Topic] = history
+
+	subs := make([]*Subscription, 0, len(h.subs[event.Topic]))
+	for sub := range h.subs[event.Topic] {
+		subs = append(subs, sub)
+	}
+	h.mu.Unlock()
+
+	for _, sub := range subs {
+		select {
+		case sub.events <- event:
+		default:
+			h.logger.WithField("topic", event.Topic).Warn("stream: subscriber is too slow, disconnecting")
+			sub.Close()
+		}
+	}
+}
+
+// Subscription receives events for its topics until Close is called.
+type Subscription struct {
+	hub       *Hub
+	topics    []string
+	events    chan Event
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Events returns the channel of live events.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Done is closed when the subscription is closed.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.closed
+}
+
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		s.hub.unsubscribe(s)
+		close(s.closed)
+	})
+}
@@ -0,0 +1,124 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHub_PublishAndReplay(t *testing.T) {
+	hub := NewHub(nil, Config{History: 2}, nil)
+	ctx := context.Background()
+
+	_ = hub.Publish(ctx, "event", "created", 1)
+	_ = hub.Publish(ctx, "event", "created", 2)
+	_ = hub.Publish(ctx, "event", "created", 3)
+
+	sub, replay := hub.Subscribe([]string{"event"}, hub.history["event"][0].ID)
+	defer sub.Close()
+
+	assert.Len(t, replay, 1)
+	assert.Equal(t, "3", string(replay[0].Data))
+
+	_ = hub.Publish(ctx, "user", "created", 4)
+	_ = hub.Publish(ctx, "event", "updated", 5)
+
+	select {
+	case event := <-sub.Events():
+		assert.Equal(t, "updated", event.Type)
+		assert.Equal(t, "5", string(event.Data))
+	case <-time.After(time.Second):
+		t.Fatal("event was not delivered")
+	}
+}
+
+func TestHub_Handler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := NewHub(nil, Config{}, nil)
+
+	router := gin.New()
+	router.GET("/stream", hub.Handler(func(_ *gin.Context, topic string) bool {
+		return topic != "secret"
+	}))
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/stream?topic=secret")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	_ = resp.Body.Close()
+
+	resp, err = http.Get(srv.URL + "/stream?topic=event")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	assert.Eventually(t, func() bool {
+		hub.mu.RLock()
+		defer hub.mu.RUnlock()
+		return len(hub.subs["event"]) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	_ = hub.Publish(context.Background(), "event", "created", map[string]int{"id": 1})
+
+	reader := bufio.NewReader(resp.Body)
+	lines := make([]string, 0, 3)
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		lines = append(lines, strings.TrimSpace(line))
+	}
+
+	assert.True(t, strings.HasPrefix(lines[0], "id: "))
+	assert.Equal(t, "event: created", lines[1])
+	assert.Contains(t, lines[2], `"data":{"id":1}`)
+
+	hub.Close()
+}
+
+func TestHub_HandlerWithFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := NewHub(nil, Config{}, nil)
+	ctx := context.Background()
+
+	router := gin.New()
+	router.GET("/stream", hub.HandlerWithFilter(nil, func(_ *gin.Context, restriction Restriction) bool {
+		return restriction.OwnerId == 7
+	}))
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	_ = hub.Publish(ctx, "event", "created", map[string]int{"id": 1})
+	first := hub.history["event"][0].ID
+	_ = hub.PublishRestricted(ctx, "event", "updated", map[string]int{"id": 2}, Restriction{Permission: "event.read", OwnerId: 8})
+	_ = hub.PublishRestricted(ctx, "event", "updated", map[string]int{"id": 3}, Restriction{Permission: "event.read", OwnerId: 7})
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/stream?topic=event", nil)
+	req.Header.Set("Last-Event-ID", first)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	lines := make([]string, 0, 3)
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		lines = append(lines, strings.TrimSpace(line))
+	}
+
+	// Событие чужой модели пропущено, ограничение клиенту не отправляется
+	assert.Contains(t, lines[2], `"data":{"id":3}`)
+	assert.NotContains(t, lines[2], "restriction")
+
+	hub.Close()
+}
@@ -0,0 +1,55 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisBroker distributes events through a Redis pub/sub channel.
+type RedisBroker struct {
+	client  *redis.Client
+	channel string
+}
+
+func NewRedisBroker(client *redis.Client, channel string) *RedisBroker {
+	return &RedisBroker{client: client, channel: channel}
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(ctx, b.channel, data).Err()
+}
+
+func (b *RedisBroker) Subscribe(ctx context.Context, handler func(Event)) error {
+	pubsub := b.client.Subscribe(ctx, b.channel)
+	defer func() {
+		_ = pubsub.Close()
+	}()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+
+			var event Event
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				continue
+			}
+			handler(event)
+		}
+	}
+}
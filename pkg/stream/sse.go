@@ -0,0 +1,108 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler serves Server-Sent Events for the topics listed in the "topic" query parameter
+// (comma separated). authorize is called for every requested topic, nil allows all topics.
+// Clients resume with the standard Last-Event-ID header or the lastEventId query parameter.
+// Events of PublishRestricted are not delivered, they need HandlerWithFilter.
+func (h *Hub) Handler(authorize func(c *gin.Context, topic string) bool) gin.HandlerFunc {
+	return h.HandlerWithFilter(authorize, nil)
+}
+
+// HandlerWithFilter is Handler which calls filter for every event with a Restriction,
+// the event is skipped for the subscriber if filter returns false. Nil filter skips all such events.
+func (h *Hub) HandlerWithFilter(authorize func(c *gin.Context, topic string) bool, filter func(c *gin.Context, restriction Restriction) bool) gin.HandlerFunc {
+	deliver := func(c *gin.Context, event Event) error {
+		if event.Restriction != nil && (filter == nil || !filter(c, *event.Restriction)) {
+			return nil
+		}
+		return writeEvent(c, event)
+	}
+
+	return func(c *gin.Context) {
+		topics := make([]string, 0)
+		for _, topic := range strings.Split(c.Query("topic"), ",") {
+			topic = strings.TrimSpace(topic)
+			if topic == "" {
+				continue
+			}
+			if authorize != nil && !authorize(c, topic) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "You has no access to topic " + topic})
+				return
+			}
+			topics = append(topics, topic)
+		}
+
+		if len(topics) == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "topic is empty"})
+			return
+		}
+
+		lastEventId := c.GetHeader("Last-Event-ID")
+		if lastEventId == "" {
+			lastEventId = c.Query("lastEventId")
+		}
+
+		sub, replay := h.Subscribe(topics, lastEventId)
+		defer sub.Close()
+
+		header := c.Writer.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("Connection", "keep-alive")
+		header.Set("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+
+		for _, event := range replay {
+			if deliver(c, event) != nil {
+				return
+			}
+		}
+
+		heartbeat := time.NewTicker(h.config.Heartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case <-sub.Done():
+				return
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+					return
+				}
+				c.Writer.Flush()
+			case event := <-sub.Events():
+				if deliver(c, event) != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func writeEvent(c *gin.Context, event Event) error {
+	event.Restriction = nil
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	if err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/iteais/sdk/pkg/redact"
+	"github.com/uptrace/bun"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryHook creates a span for every bun query.
+type QueryHook struct{}
+
+var _ bun.QueryHook = QueryHook{}
+
+func (QueryHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	ctx, _ = Tracer().Start(ctx, "db "+event.Operation(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(event.StartTime),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(event.Operation()),
+			// Значения строк (email, хеши токенов) в трейсы не попадают
+			semconv.DBQueryText(redact.Query(event.Query)),
+		))
+	return ctx
+}
+
+func (QueryHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	if event.Result != nil {
+		if rows, err := event.Result.RowsAffected(); err == nil {
+			span.SetAttributes(attribute.Int64("db.rows_affected", rows))
+		}
+	}
+
+	if event.Err != nil && !errors.Is(event.Err, sql.ErrNoRows) {
+		span.RecordError(event.Err)
+		span.SetStatus(codes.Error, event.Err.Error())
+	}
+}
@@ -0,0 +1,158 @@
+// Package tracing configures OpenTelemetry tracing and instruments HTTP clients, bun and Redis.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/iteais/sdk"
+
+type Config struct {
+	ServiceName string
+	Environment string
+	// Exporter receives every span synchronously, e.g. tracetest.NewInMemoryExporter() in tests.
+	// Default by OTEL_TRACES_EXPORTER: "otlp" (OTEL_EXPORTER_OTLP_* env), "console" or "none".
+	// Without the variable otlp is used when OTEL_EXPORTER_OTLP_ENDPOINT is set.
+	Exporter sdktrace.SpanExporter
+	// SampleRatio of new traces and of X-Trace-Id traces, traceparent of callers is followed.
+	// Default OTEL_TRACES_SAMPLER_ARG or 1.
+	SampleRatio float64
+}
+
+// Init installs the global tracer provider and the W3C trace context propagator.
+// The returned function flushes and stops the exporter.
+func Init(config Config) (func(context.Context) error, error) {
+	if config.SampleRatio <= 0 {
+		config.SampleRatio = 1
+		if ratio, err := strconv.ParseFloat(os.Getenv("OTEL_TRACES_SAMPLER_ARG"), 64); err == nil {
+			config.SampleRatio = ratio
+		}
+	}
+
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(newSampler(config.SampleRatio)),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(config.ServiceName),
+			semconv.DeploymentEnvironment(config.Environment),
+		)),
+	}
+
+	if config.Exporter != nil {
+		options = append(options, sdktrace.WithSyncer(config.Exporter))
+	} else {
+		exporter := strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER"))
+		if exporter == "" && (os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "") {
+			exporter = "otlp"
+		}
+
+		switch exporter {
+		case "otlp":
+			otlp, err := otlptracehttp.New(context.Background())
+			if err != nil {
+				return nil, err
+			}
+			options = append(options, sdktrace.WithBatcher(otlp))
+		case "console", "stdout":
+			stdout, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+			if err != nil {
+				return nil, err
+			}
+			options = append(options, sdktrace.WithSyncer(stdout))
+		}
+		// Without an exporter spans are still created, so trace ids are propagated and logged.
+	}
+
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// TraceId returns the trace id of the span in ctx formatted as UUID, the format of X-Trace-Id.
+func TraceId(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	traceId := spanContext.TraceID()
+	return uuid.UUID(traceId).String()
+}
+
+// ContextWithTraceId continues the trace of a legacy X-Trace-Id UUID when the caller did not send traceparent.
+// Values which are not UUIDs are ignored. The header carries no sampling decision, so such traces are
+// sampled by SampleRatio like new ones.
+func ContextWithTraceId(ctx context.Context, traceIdHeader string) context.Context {
+	id, err := uuid.Parse(traceIdHeader)
+	if err != nil {
+		return ctx
+	}
+
+	var spanId trace.SpanID
+	_, _ = rand.Read(spanId[:])
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID(id),
+		SpanID:  spanId,
+		Remote:  true,
+	})
+	if !spanContext.IsValid() {
+		return ctx
+	}
+
+	ctx = context.WithValue(ctx, legacyParentKey{}, true)
+	return trace.ContextWithRemoteSpanContext(ctx, spanContext)
+}
+
+type legacyParentKey struct{}
+
+// newSampler follows the decision of traceparent and samples new traces and X-Trace-Id traces by ratio.
+func newSampler(ratio float64) sdktrace.Sampler {
+	root := sdktrace.TraceIDRatioBased(ratio)
+	return sdktrace.ParentBased(root, sdktrace.WithRemoteParentNotSampled(legacyParentSampler{ratio: root}))
+}
+
+// legacyParentSampler samples remote parents of ContextWithTraceId by ratio, they have no sampling decision.
+// Other remote parents which are not sampled stay not sampled.
+type legacyParentSampler struct {
+	ratio sdktrace.Sampler
+}
+
+func (s legacyParentSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if legacy, _ := p.ParentContext.Value(legacyParentKey{}).(bool); legacy {
+		return s.ratio.ShouldSample(p)
+	}
+	return sdktrace.NeverSample().ShouldSample(p)
+}
+
+func (s legacyParentSampler) Description() string {
+	return "LegacyParent{" + s.ratio.Description() + "}"
+}
+
+// Inject writes traceparent of ctx into an outgoing carrier, e.g. propagation.HeaderCarrier(req.Header).
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+}
+
+// Extract reads traceparent of an incoming carrier.
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
@@ -0,0 +1,133 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func initTest(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown, err := Init(Config{ServiceName: "test", Exporter: exporter})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = shutdown(context.Background())
+	})
+	return exporter
+}
+
+func TestTraceIdAlias(t *testing.T) {
+	initTest(t)
+
+	ctx := ContextWithTraceId(context.Background(), "4bf92f35-77b3-4da6-a3ce-929d0e0e4736")
+	ctx, span := Tracer().Start(ctx, "child")
+	defer span.End()
+
+	assert.Equal(t, "4bf92f35-77b3-4da6-a3ce-929d0e0e4736", TraceId(ctx))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+
+	assert.Equal(t, context.Background(), ContextWithTraceId(context.Background(), "not-a-uuid"))
+	assert.Empty(t, TraceId(context.Background()))
+}
+
+func TestTraceIdAliasIsSampledByRatio(t *testing.T) {
+	shutdown, err := Init(Config{ServiceName: "test", Exporter: tracetest.NewInMemoryExporter(), SampleRatio: 1e-9})
+	require.NoError(t, err)
+	defer func() {
+		_ = shutdown(context.Background())
+	}()
+
+	// X-Trace-Id не дает клиенту включить сэмплирование в обход SampleRatio
+	ctx := ContextWithTraceId(context.Background(), "4bf92f35-77b3-4da6-a3ce-929d0e0e4736")
+	_, span := Tracer().Start(ctx, "legacy")
+	span.End()
+	assert.False(t, span.SpanContext().IsSampled())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+
+	// Решение вызывающего из traceparent соблюдается
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    span.SpanContext().TraceID(),
+		SpanID:     span.SpanContext().SpanID(),
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	_, span = Tracer().Start(trace.ContextWithRemoteSpanContext(context.Background(), parent), "w3c")
+	span.End()
+	assert.True(t, span.SpanContext().IsSampled())
+}
+
+func TestTransport(t *testing.T) {
+	exporter := initTest(t)
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	ctx, parent := Tracer().Start(context.Background(), "parent")
+	req, _ := http.NewRequestWithContext(WithResendCount(ctx, 2), http.MethodGet, server.URL+"/user/1", nil)
+	resp, err := NewTransport(nil).RoundTrip(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	parent.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+
+	client := spans[0]
+	assert.Equal(t, "HTTP GET", client.Name)
+	assert.Equal(t, trace.SpanKindClient, client.SpanKind)
+	assert.Equal(t, parent.SpanContext().SpanID(), client.Parent.SpanID())
+	assert.Contains(t, traceparent, client.SpanContext.SpanID().String())
+	assert.Equal(t, "Error", client.Status.Code.String())
+
+	attributes := map[string]any{}
+	for _, attr := range client.Attributes {
+		attributes[string(attr.Key)] = attr.Value.AsInterface()
+	}
+	assert.EqualValues(t, 502, attributes["http.response.status_code"])
+	assert.EqualValues(t, 2, attributes["http.request.resend_count"])
+}
+
+func TestQueryHook(t *testing.T) {
+	exporter := initTest(t)
+
+	sqldb, err := sql.Open(sqliteshim.ShimName, "file::memory:")
+	require.NoError(t, err)
+	db := bun.NewDB(sqldb, sqlitedialect.New())
+	defer func() {
+		_ = db.Close()
+	}()
+	db.AddQueryHook(QueryHook{})
+
+	ctx, parent := Tracer().Start(context.Background(), "parent")
+	var one int
+	require.NoError(t, db.NewSelect().ColumnExpr("1").Where("? <> ''", "john@example.com").Scan(ctx, &one))
+	_, err = db.ExecContext(ctx, "SELECT * FROM missing")
+	assert.Error(t, err)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "db SELECT", spans[0].Name)
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, "Error", spans[1].Status.Code.String())
+
+	for _, attr := range spans[0].Attributes {
+		if attr.Key == "db.query.text" {
+			assert.Equal(t, "SELECT 1 WHERE ('?' <> '?')", attr.Value.AsString())
+		}
+	}
+}
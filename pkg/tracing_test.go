@@ -0,0 +1,97 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iteais/sdk/pkg/tracing"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceMiddleware_InternalFetch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown, err := tracing.Init(tracing.Config{ServiceName: "test", Exporter: exporter})
+	require.NoError(t, err)
+	defer func() {
+		_ = shutdown(context.Background())
+	}()
+
+	previous := App
+	App = &Application{Log: logrus.New()}
+	defer func() {
+		App = previous
+	}()
+
+	var attempts atomic.Int32
+	var downstreamTraceparent string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downstreamTraceparent = r.Header.Get("traceparent")
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer downstream.Close()
+
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(TraceMiddleware())
+	router.GET("/user/:id", func(c *gin.Context) {
+		resp := InternalFetch(InternalFetchConfig{Context: c, Method: http.MethodGet, Url: downstream.URL})
+		_ = resp.Body.Close()
+		c.Status(resp.StatusCode)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/user/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "4bf92f35-77b3-4da6-a3ce-929d0e0e4736", w.Header().Get(TraceIdHttpHeader))
+	assert.Contains(t, downstreamTraceparent, "4bf92f3577b34da6a3ce929d0e0e4736")
+
+	spans := exporter.GetSpans()
+	names := make([]string, 0, len(spans))
+	for _, span := range spans {
+		names = append(names, span.Name)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+	}
+	assert.Equal(t, []string{"HTTP GET", "HTTP GET", "InternalFetch GET", "GET /user/:id"}, names)
+
+	server := spans[3]
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	assert.Equal(t, server.SpanContext.SpanID(), spans[2].Parent.SpanID())
+	assert.Equal(t, spans[2].SpanContext.SpanID(), spans[1].Parent.SpanID())
+}
+
+func TestTraceMiddleware_LegacyTraceId(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(TraceMiddleware())
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(TraceIdContextKey))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(TraceIdHttpHeader, "legacy-id")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "legacy-id", w.Body.String())
+	assert.Equal(t, "legacy-id", w.Header().Get(TraceIdHttpHeader))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Len(t, w.Body.String(), 36)
+}
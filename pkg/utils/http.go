@@ -5,6 +5,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"net"
 	"os"
+	"strings"
 )
 
 const AuthHeader = "User-Jwt"
@@ -29,25 +30,67 @@ func LocalIps() []net.IP {
 	return retAddrs
 }
 
-// CheckIpsInSameSubnet Проверка вхождения подсети
+// CheckIpsInSameSubnet Проверка вхождения подсети: /24 для IPv4 и /64 для IPv6
 func CheckIpsInSameSubnet(ip1IP net.IP, ip2IP net.IP) bool {
 	if ip1IP == nil || ip2IP == nil {
 		return false
 	}
 
-	// Получаем маску по умолчанию для IPv4, которая равна 32 (все биты)
+	if (ip1IP.To4() == nil) != (ip2IP.To4() == nil) {
+		return false
+	}
+
 	defaultMask := net.CIDRMask(24, 32)
+	if ip1IP.To4() == nil {
+		defaultMask = net.CIDRMask(64, 128)
+	}
+
 	network1 := ip1IP.Mask(defaultMask)
 	network2 := ip2IP.Mask(defaultMask)
 
 	return network1.Equal(network2)
 }
 
+// ParseNetworks разбирает список CIDR, одиночный IP считается сетью /32 или /128
+func ParseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// FindNetwork возвращает первую сеть, содержащую ip
+func FindNetwork(ip net.IP, networks []*net.IPNet) *net.IPNet {
+	if ip == nil {
+		return nil
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return network
+		}
+	}
+	return nil
+}
+
+// GetRequestJwt проверяет User-Jwt секретом JWT_SECRET, для JWKS, iss и aud используйте auth.Verifier
 func GetRequestJwt(c *gin.Context) (*jwt.Token, error) {
 	tokenString := c.Request.Header.Get(AuthHeader)
 
 	return jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
 		// hmacSampleSecret is a []byte containing your secret, e.g. []byte("my_secret_key")
 		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
+	}, jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}))
 }
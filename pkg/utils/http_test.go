@@ -31,6 +31,22 @@ func TestCheckIpsInSameSubnet(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name: "ipv6_in_same_subnet_true",
+			args: args{
+				clientIP: net.ParseIP("2001:db8::1"),
+				serverIP: net.ParseIP("2001:db8::ff"),
+			},
+			want: true,
+		},
+		{
+			name: "ipv6_and_ipv4_false",
+			args: args{
+				clientIP: net.ParseIP("::ffff:0:0"),
+				serverIP: net.ParseIP("2001:db8::ff"),
+			},
+			want: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -40,3 +56,36 @@ func TestCheckIpsInSameSubnet(t *testing.T) {
 		})
 	}
 }
+
+func TestFindNetwork(t *testing.T) {
+	networks, err := ParseNetworks([]string{"10.0.0.0/8", "fd00::/8", "192.168.1.5"})
+	if err != nil {
+		t.Fatalf("ParseNetworks() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		ip   string
+		want string
+	}{
+		{name: "ipv4_cidr", ip: "10.1.2.3", want: "10.0.0.0/8"},
+		{name: "ipv6_cidr", ip: "fd12::1", want: "fd00::/8"},
+		{name: "single_ip", ip: "192.168.1.5", want: "192.168.1.5/32"},
+		{name: "not_trusted", ip: "192.168.1.6", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if network := FindNetwork(net.ParseIP(tt.ip), networks); network != nil {
+				got = network.String()
+			}
+			if got != tt.want {
+				t.Errorf("FindNetwork() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err = ParseNetworks([]string{"not-a-network"}); err == nil {
+		t.Errorf("ParseNetworks() expected error")
+	}
+}
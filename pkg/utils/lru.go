@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is a size bounded cache with per entry expiration. It is safe for concurrent use.
+type LRU[K comparable, V any] struct {
+	mu    sync.Mutex
+	size  int
+	items map[K]*list.Element
+	order *list.List
+}
+
+type lruEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+func NewLRU[K comparable, V any](size int) *LRU[K, V] {
+	if size <= 0 {
+		size = 1
+	}
+	return &LRU[K, V]{
+		size:  size,
+		items: make(map[K]*list.Element, size),
+		order: list.New(),
+	}
+}
+
+// Get returns the value if it exists and is not expired.
+func (l *LRU[K, V]) Get(key K) (V, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var zero V
+	el, ok := l.items[key]
+	if !ok {
+		return zero, false
+	}
+
+	entry := el.Value.(*lruEntry[K, V])
+	if time.Now().After(entry.expires) {
+		l.order.Remove(el)
+		delete(l.items, key)
+		return zero, false
+	}
+
+	l.order.MoveToFront(el)
+	return entry.value, true
+}
+
+// Set stores the value for ttl, evicting the least recently used entry if the cache is full.
+func (l *LRU[K, V]) Set(key K, value V, ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[key]; ok {
+		entry := el.Value.(*lruEntry[K, V])
+		entry.value = value
+		entry.expires = time.Now().Add(ttl)
+		l.order.MoveToFront(el)
+		return
+	}
+
+	l.items[key] = l.order.PushFront(&lruEntry[K, V]{key: key, value: value, expires: time.Now().Add(ttl)})
+
+	if l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
+
+func (l *LRU[K, V]) Delete(key K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[key]; ok {
+		l.order.Remove(el)
+		delete(l.items, key)
+	}
+}
+
+func (l *LRU[K, V]) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.order.Len()
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	cache := NewLRU[string, int](2)
+
+	cache.Set("a", 1, time.Minute)
+	cache.Set("b", 2, time.Minute)
+
+	if _, ok := cache.Get("a"); !ok {
+		t.Errorf("Get(a) not found")
+	}
+
+	// "b" is the least recently used now
+	cache.Set("c", 3, time.Minute)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("Get(b) should be evicted")
+	}
+	if v, _ := cache.Get("c"); v != 3 {
+		t.Errorf("Get(c) = %v, want 3", v)
+	}
+
+	cache.Delete("c")
+	if cache.Len() != 1 {
+		t.Errorf("Len() = %v, want 1", cache.Len())
+	}
+
+	cache.Set("d", 4, -time.Second)
+	if _, ok := cache.Get("d"); ok {
+		t.Errorf("Get(d) should be expired")
+	}
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// CanonicalRequest builds the string signed by the v2 HMAC scheme:
+//
+//	METHOD\nPATH\nSORTED_QUERY\nHEX(SHA256(BODY))\nTIME[\nNONCE]
+//
+// Query parameters are sorted by key and value and encoded with url.QueryEscape.
+// The nonce line is only present when nonce is not empty.
+func CanonicalRequest(method string, path string, query url.Values, body []byte, time string, nonce string) string {
+	pairs := make([]string, 0, len(query))
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+	sort.Strings(pairs)
+
+	if path == "" {
+		path = "/"
+	}
+
+	digest := sha256.Sum256(body)
+
+	lines := []string{
+		strings.ToUpper(method),
+		path,
+		strings.Join(pairs, "&"),
+		hex.EncodeToString(digest[:]),
+		time,
+	}
+	if nonce != "" {
+		lines = append(lines, nonce)
+	}
+
+	return strings.Join(lines, "\n")
+}
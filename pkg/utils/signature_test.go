@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCanonicalRequest(t *testing.T) {
+	query, _ := url.ParseQuery("b=2&a=3&a=1&c=x y")
+
+	got := CanonicalRequest("post", "/user/1", query, []byte(`{"id":1}`), "1700000000", "")
+	want := "POST\n/user/1\na=1&a=3&b=2&c=x+y\n" +
+		"037c9214eef74cc3887f3a4f085b4e17d76280dafd273b0ee160c09c4ba1cfd4\n1700000000"
+
+	if got != want {
+		t.Errorf("CanonicalRequest() = %q, want %q", got, want)
+	}
+
+	empty := CanonicalRequest("GET", "", nil, nil, "1", "")
+	if empty != "GET\n/\n\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n1" {
+		t.Errorf("CanonicalRequest() = %q", empty)
+	}
+
+	withNonce := CanonicalRequest("GET", "", nil, nil, "1", "abc")
+	if withNonce != empty+"\nabc" {
+		t.Errorf("CanonicalRequest() = %q", withNonce)
+	}
+}